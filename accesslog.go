@@ -0,0 +1,233 @@
+package httpx
+
+import (
+	"fmt"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 访问日志可选字段
+const (
+	AccessLogFieldStatus    = "status"
+	AccessLogFieldMethod    = "method"
+	AccessLogFieldPath      = "path"
+	AccessLogFieldRoute     = "route"
+	AccessLogFieldQuery     = "query"
+	AccessLogFieldLatency   = "times"
+	AccessLogFieldIP        = "ip"
+	AccessLogFieldUserAgent = "user_agent"
+	AccessLogFieldReferer   = "referer"
+	AccessLogFieldBytesIn   = "bytes_in"
+	AccessLogFieldBytesOut  = "bytes_out"
+	AccessLogFieldHeaders   = "headers"
+	AccessLogFieldError     = "error"
+	AccessLogFieldRequestID = "request_id"
+)
+
+var defaultAccessLogFields = []string{
+	AccessLogFieldStatus, AccessLogFieldMethod, AccessLogFieldPath, AccessLogFieldRoute, AccessLogFieldLatency,
+	AccessLogFieldIP, AccessLogFieldUserAgent, AccessLogFieldBytesIn, AccessLogFieldBytesOut, AccessLogFieldError,
+	AccessLogFieldRequestID,
+}
+
+var defaultRedactHeaders = []string{fiber.HeaderAuthorization, fiber.HeaderProxyAuthorization, fiber.HeaderCookie, fiber.HeaderSetCookie}
+
+const redacted = "***"
+
+// AccessLogConfig 访问日志配置
+type AccessLogConfig struct {
+	// Fields 输出的字段,为空时输出 status、method、path、route、times、ip、user_agent、bytes_in、bytes_out、error、request_id
+	Fields []string
+	// SuccessSampling 成功请求每 N 个记录1个,小于等于1时全部记录,慢请求和4xx、5xx请求始终记录
+	SuccessSampling int64
+	// SlowThreshold 耗时超过该值的请求以 Warn 级别记录,为0时不区分慢请求
+	SlowThreshold time.Duration
+	// Headers headers 字段中输出的请求头
+	Headers []string
+	// RedactHeaders 需要脱敏的请求头,为空时使用 Authorization、Proxy-Authorization、Cookie、Set-Cookie
+	RedactHeaders []string
+	// RedactQuery 需要脱敏的URL参数
+	RedactQuery []string
+	// SkipPaths 不记录日志的路径,如 /healthz
+	SkipPaths []string
+	// CombinedWriter 不为空时同时以 Apache Combined 格式输出到该 writer
+	CombinedWriter io.Writer
+	// Logger 输出访问日志的 logger,为空时使用 coffeehc/base/log
+	Logger *zap.Logger
+}
+
+// AccessLogMiddleware 使用默认配置记录访问日志
+func AccessLogMiddleware() fiber.Handler {
+	return AccessLogMiddlewareWithConfig(AccessLogConfig{})
+}
+
+// AccessLogMiddlewareWithConfig 记录访问日志,成功请求为 Debug 级别,4xx 为 Info 级别,
+// 慢请求为 Warn 级别,5xx 为 Error 级别
+func AccessLogMiddlewareWithConfig(config AccessLogConfig) fiber.Handler {
+	fields := make(map[string]bool)
+	if len(config.Fields) == 0 {
+		config.Fields = defaultAccessLogFields
+	}
+	for _, field := range config.Fields {
+		fields[field] = true
+	}
+	if len(config.RedactHeaders) == 0 {
+		config.RedactHeaders = defaultRedactHeaders
+	}
+	skipPaths := make(map[string]bool, len(config.SkipPaths))
+	for _, path := range config.SkipPaths {
+		skipPaths[path] = true
+	}
+	logger := newLevelLogger(config.Logger)
+	var combinedMutex sync.Mutex
+	var successCount atomic.Int64
+	return func(c *fiber.Ctx) error {
+		if skipPaths[c.Path()] {
+			return c.Next()
+		}
+		start := time.Now()
+		err := c.Next()
+		latency := time.Since(start)
+		status := responseStatus(c, err)
+		if config.CombinedWriter != nil {
+			line := combinedLogLine(c, start, status, config.RedactQuery)
+			combinedMutex.Lock()
+			config.CombinedWriter.Write(line)
+			combinedMutex.Unlock()
+		}
+		slow := config.SlowThreshold > 0 && latency >= config.SlowThreshold
+		if status < fiber.StatusBadRequest && !slow && config.SuccessSampling > 1 && successCount.Add(1)%config.SuccessSampling != 1 {
+			return err
+		}
+		logFields := accessLogFields(c, fields, &config, status, latency, err)
+		switch {
+		case status >= fiber.StatusInternalServerError:
+			logger.error("HTTP访问", logFields...)
+		case slow:
+			logger.warn("HTTP慢请求", logFields...)
+		case status >= fiber.StatusBadRequest:
+			logger.info("HTTP访问", logFields...)
+		default:
+			logger.debug("HTTP访问", logFields...)
+		}
+		return err
+	}
+}
+
+// responseStatus 返回请求最终的状态码。c.Next() 返回的错误此时还未交给 ErrorHandler 处理,
+// 按 httpxcommons.MapError 取 DefaultErrorHandler 会返回的状态码,自定义 ErrorHandler 时应与错误转换规则保持一致
+func responseStatus(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	return httpxcommons.MapError(err).StatusCode
+}
+
+func accessLogFields(c *fiber.Ctx, fields map[string]bool, config *AccessLogConfig, status int, latency time.Duration, err error) []zap.Field {
+	logFields := make([]zap.Field, 0, len(fields))
+	if fields[AccessLogFieldStatus] {
+		logFields = append(logFields, zap.Int(AccessLogFieldStatus, status))
+	}
+	if fields[AccessLogFieldMethod] {
+		logFields = append(logFields, zap.String(AccessLogFieldMethod, c.Method()))
+	}
+	if fields[AccessLogFieldPath] {
+		logFields = append(logFields, zap.String(AccessLogFieldPath, c.Path()))
+	}
+	if fields[AccessLogFieldRoute] {
+		logFields = append(logFields, zap.String(AccessLogFieldRoute, c.Route().Path))
+	}
+	if fields[AccessLogFieldQuery] {
+		logFields = append(logFields, zap.String(AccessLogFieldQuery, redactQuery(string(c.Request().URI().QueryString()), config.RedactQuery)))
+	}
+	if fields[AccessLogFieldLatency] {
+		logFields = append(logFields, zap.Duration(AccessLogFieldLatency, latency))
+	}
+	if fields[AccessLogFieldIP] {
+		logFields = append(logFields, zap.String(AccessLogFieldIP, c.IP()))
+	}
+	if fields[AccessLogFieldUserAgent] {
+		logFields = append(logFields, zap.String(AccessLogFieldUserAgent, c.Get(fiber.HeaderUserAgent)))
+	}
+	if fields[AccessLogFieldReferer] {
+		logFields = append(logFields, zap.String(AccessLogFieldReferer, c.Get(fiber.HeaderReferer)))
+	}
+	if fields[AccessLogFieldBytesIn] {
+		logFields = append(logFields, zap.Int(AccessLogFieldBytesIn, requestSize(c)))
+	}
+	if fields[AccessLogFieldBytesOut] {
+		logFields = append(logFields, zap.Int(AccessLogFieldBytesOut, responseSize(c)))
+	}
+	if fields[AccessLogFieldHeaders] && len(config.Headers) > 0 {
+		headers := make(map[string]string, len(config.Headers))
+		for _, name := range config.Headers {
+			if value := c.Get(name); value != "" {
+				if containsFold(config.RedactHeaders, name) {
+					value = redacted
+				}
+				headers[name] = value
+			}
+		}
+		logFields = append(logFields, zap.Any(AccessLogFieldHeaders, headers))
+	}
+	if fields[AccessLogFieldRequestID] {
+		logFields = append(logFields, zap.String(AccessLogFieldRequestID, httpxcommons.GetRequestID(c)))
+	}
+	if fields[AccessLogFieldError] && err != nil {
+		logFields = append(logFields, zap.Error(err))
+	}
+	return logFields
+}
+
+// redactQuery 将需要脱敏的URL参数值替换为 ***
+func redactQuery(query string, keys []string) string {
+	if query == "" || len(keys) == 0 {
+		return query
+	}
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		key, _, _ := strings.Cut(pair, "=")
+		if name, err := url.QueryUnescape(key); err == nil && containsFold(keys, name) {
+			pairs[i] = key + "=" + redacted
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func containsFold(values []string, v string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// combinedLogLine 生成 Apache Combined 格式的日志行
+func combinedLogLine(c *fiber.Ctx, start time.Time, status int, redactKeys []string) []byte {
+	uri := c.Path()
+	if query := redactQuery(string(c.Request().URI().QueryString()), redactKeys); query != "" {
+		uri += "?" + query
+	}
+	size := "-"
+	if n := responseSize(c); n > 0 {
+		size = fmt.Sprint(n)
+	}
+	return []byte(fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s %q %q\n",
+		c.IP(), start.Format("02/Jan/2006:15:04:05 -0700"), c.Method(), uri, c.Request().Header.Protocol(), status, size,
+		orDash(c.Get(fiber.HeaderReferer)), orDash(c.Get(fiber.HeaderUserAgent))))
+}
+
+func orDash(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}
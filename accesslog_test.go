@@ -0,0 +1,158 @@
+package httpx
+
+import (
+	"bytes"
+	es "errors"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// newAccessLogApp 使用 config 创建记录访问日志的应用,返回应用和捕获到的日志
+func newAccessLogApp(config AccessLogConfig) (*fiber.App, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	config.Logger = zap.New(core)
+	app := fiber.New(fiber.Config{ErrorHandler: DefaultErrorHandler})
+	app.Use(AccessLogMiddlewareWithConfig(config))
+	app.Get("/ok", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	app.Get("/bad", func(c *fiber.Ctx) error {
+		return fiber.ErrBadRequest
+	})
+	app.Get("/fail", func(c *fiber.Ctx) error {
+		return es.New("db: connection refused")
+	})
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		time.Sleep(30 * time.Millisecond)
+		return c.SendString("slow")
+	})
+	return app, logs
+}
+
+func sendAccessLogRequest(t *testing.T, app *fiber.App, target string, headers map[string]string) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodGet, target, nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if _, err := app.Test(req); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAccessLogLevels(t *testing.T) {
+	app, logs := newAccessLogApp(AccessLogConfig{SlowThreshold: 20 * time.Millisecond})
+	cases := []struct {
+		target  string
+		level   zapcore.Level
+		message string
+		status  int64
+	}{
+		{"/ok", zapcore.DebugLevel, "HTTP访问", fiber.StatusOK},
+		{"/bad", zapcore.InfoLevel, "HTTP访问", fiber.StatusBadRequest},
+		{"/slow", zapcore.WarnLevel, "HTTP慢请求", fiber.StatusOK},
+		{"/fail", zapcore.ErrorLevel, "HTTP访问", fiber.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		sendAccessLogRequest(t, app, tc.target, nil)
+		entries := logs.TakeAll()
+		if len(entries) != 1 {
+			t.Fatalf("%s: 应记录1条日志, got %d", tc.target, len(entries))
+		}
+		entry := entries[0]
+		fields := entry.ContextMap()
+		if entry.Level != tc.level || entry.Message != tc.message || fields[AccessLogFieldStatus] != tc.status || fields[AccessLogFieldPath] != tc.target {
+			t.Fatalf("%s: level=%s message=%s fields=%v", tc.target, entry.Level, entry.Message, fields)
+		}
+	}
+}
+
+// 成功请求按 SuccessSampling 采样,4xx、5xx 和慢请求始终记录
+func TestAccessLogSampling(t *testing.T) {
+	app, logs := newAccessLogApp(AccessLogConfig{SuccessSampling: 3, SlowThreshold: 20 * time.Millisecond})
+	for i := 0; i < 7; i++ {
+		sendAccessLogRequest(t, app, "/ok", nil)
+	}
+	// 日志字段引用 fiber 复用的缓冲区,每批请求后立即取出日志
+	if n := len(logs.TakeAll()); n != 3 {
+		t.Fatalf("7个成功请求每3个记录1个, 应记录3条, got %d", n)
+	}
+	for _, target := range []string{"/bad", "/fail", "/slow"} {
+		for i := 0; i < 3; i++ {
+			sendAccessLogRequest(t, app, target, nil)
+		}
+		if n := len(logs.TakeAll()); n != 3 {
+			t.Fatalf("%s 不应被采样, got %d", target, n)
+		}
+	}
+}
+
+func TestAccessLogRedaction(t *testing.T) {
+	app, logs := newAccessLogApp(AccessLogConfig{
+		Fields:      []string{AccessLogFieldPath, AccessLogFieldQuery, AccessLogFieldHeaders},
+		Headers:     []string{fiber.HeaderAuthorization, "X-Tenant", "X-Missing"},
+		RedactQuery: []string{"token"},
+	})
+	sendAccessLogRequest(t, app, "/ok?user=a&token=secret&Token=other", map[string]string{
+		fiber.HeaderAuthorization: "Bearer secret",
+		"X-Tenant":                "t1",
+	})
+	entries := logs.TakeAll()
+	if len(entries) != 1 {
+		t.Fatalf("got %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if query := fields[AccessLogFieldQuery]; query != "user=a&token=***&Token=***" {
+		t.Fatalf("query=%v", query)
+	}
+	headers, ok := fields[AccessLogFieldHeaders].(map[string]string)
+	if !ok || len(headers) != 2 || headers[fiber.HeaderAuthorization] != redacted || headers["X-Tenant"] != "t1" {
+		t.Fatalf("headers=%#v", fields[AccessLogFieldHeaders])
+	}
+	if _, ok := fields[AccessLogFieldStatus]; ok {
+		t.Fatalf("只应输出 Fields 中的字段, got %v", fields)
+	}
+}
+
+func TestAccessLogSkipPaths(t *testing.T) {
+	combined := &bytes.Buffer{}
+	app, logs := newAccessLogApp(AccessLogConfig{SkipPaths: []string{"/ok", "/fail"}, CombinedWriter: combined})
+	sendAccessLogRequest(t, app, "/ok", nil)
+	sendAccessLogRequest(t, app, "/fail", nil)
+	if logs.Len() != 0 || combined.Len() != 0 {
+		t.Fatalf("SkipPaths 中的路径不应记录, logs=%d combined=%q", logs.Len(), combined)
+	}
+	sendAccessLogRequest(t, app, "/bad", nil)
+	if logs.Len() != 1 {
+		t.Fatalf("got %d", logs.Len())
+	}
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	combined := &bytes.Buffer{}
+	app, _ := newAccessLogApp(AccessLogConfig{CombinedWriter: combined, RedactQuery: []string{"token"}})
+	sendAccessLogRequest(t, app, "/ok?token=secret", map[string]string{
+		fiber.HeaderReferer:   "https://example.com/",
+		fiber.HeaderUserAgent: "curl/8.0",
+	})
+	sendAccessLogRequest(t, app, "/fail", nil)
+	lines := bytes.Split(bytes.TrimSuffix(combined.Bytes(), []byte("\n")), []byte("\n"))
+	patterns := []string{
+		`^0\.0\.0\.0 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /ok\?token=\*\*\* HTTP/1\.1" 200 2 "https://example\.com/" "curl/8\.0"$`,
+		`^0\.0\.0\.0 - - \[.+\] "GET /fail HTTP/1\.1" 500 - "-" "-"$`,
+	}
+	if len(lines) != len(patterns) {
+		t.Fatalf("got %q", combined)
+	}
+	for i, pattern := range patterns {
+		if !regexp.MustCompile(pattern).Match(lines[i]) {
+			t.Fatalf("第%d行不符合 Combined 格式: %s", i+1, lines[i])
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package httpx
+
+import (
+	"context"
+	"fmt"
+	"github.com/coffeehc/base/log"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+	"net"
+	"sync"
+)
+
+// newAdminEngine 创建运维端口使用的 fiber 应用,不设置写超时以便 pprof 采集较长时间的 profile
+func newAdminEngine(config *Config) (*fiber.App, error) {
+	l, err := Listen(config.AdminAddr)
+	if err != nil {
+		return nil, err
+	}
+	config.AdminAddr = l.Addr().String()
+	l.Close()
+	admin := fiber.New(fiber.Config{
+		AppName:               config.AppName,
+		ServerHeader:          config.ServerHeader,
+		DisableStartupMessage: true,
+		ReadTimeout:           config.getReadTimeout(),
+		IdleTimeout:           config.getIdleTimeout(),
+		ErrorHandler:          config.getErrorHandler(),
+	})
+	if !config.DisableRequestID {
+		admin.Use(RequestIDMiddleware(config.RequestIDHeader))
+	}
+	return admin, nil
+}
+
+// startAdmin 启动运维端口,Prefork 模式下只在主进程中启动。监听失败时返回错误,
+// 启动后运维服务异常停止时错误写入返回的 channel,未配置运维端口时返回的 channel 为空
+func (impl *serviceImpl) startAdmin() (<-chan error, error) {
+	if impl.admin == nil || fiber.IsChild() {
+		return nil, nil
+	}
+	var adminErrs chan error
+	var err error
+	impl.adminOnce.Do(func() {
+		var l net.Listener
+		l, err = Listen(impl.config.AdminAddr)
+		if err != nil {
+			err = fmt.Errorf("[%s]创建运维服务失败: %w", impl.name, err)
+			return
+		}
+		ln := &onceCloseListener{Listener: l}
+		impl.mutex.Lock()
+		impl.adminListener = ln
+		impl.mutex.Unlock()
+		adminErrs = make(chan error, 1)
+		go func() {
+			err := impl.admin.Listener(trackedListener{Listener: ln, tracker: impl.tracker})
+			if err != nil {
+				log.Error(fmt.Sprintf("[%s]运维服务异常关闭", impl.name), zap.Error(err))
+				adminErrs <- fmt.Errorf("[%s]运维服务异常关闭: %w", impl.name, err)
+			}
+			log.Debug(fmt.Sprintf("[%s]运维服务关闭", impl.name))
+		}()
+		log.Debug(fmt.Sprintf("[%s]运维服务启动", impl.name), zap.String("address", impl.config.AdminAddr))
+	})
+	return adminErrs, err
+}
+
+// shutdownAdmin 关闭运维端口。运维服务可能还没有开始 Serve,此时 fiber 的 Shutdown 不会生效,
+// 因此先直接关闭监听
+func (impl *serviceImpl) shutdownAdmin(ctx context.Context) error {
+	impl.mutex.Lock()
+	ln := impl.adminListener
+	impl.mutex.Unlock()
+	if ln == nil {
+		return nil
+	}
+	ln.Close()
+	return impl.admin.ShutdownWithContext(ctx)
+}
+
+// onceCloseListener 允许重复关闭,重复关闭时返回第一次关闭的结果
+type onceCloseListener struct {
+	net.Listener
+	once sync.Once
+	err  error
+}
+
+func (l *onceCloseListener) Close() error {
+	l.once.Do(func() {
+		l.err = l.Listener.Close()
+	})
+	return l.err
+}
+
+func (impl *serviceImpl) GetAdminEngine() *fiber.App {
+	return impl.admin
+}
@@ -0,0 +1,77 @@
+package httpx
+
+import (
+	"context"
+	es "errors"
+	"github.com/gofiber/fiber/v2"
+	"net"
+	"testing"
+	"time"
+)
+
+// withAdmin 在随机端口开启运维端口和健康检查
+func withAdmin(config *Config) {
+	config.AdminAddr = "127.0.0.1:0"
+	config.EnableHealthCheck = true
+}
+
+func adminAddr(service Service) string {
+	return service.(*serviceImpl).config.AdminAddr
+}
+
+func TestAdminServesHealth(t *testing.T) {
+	service := newTestService(t, withAdmin)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := runAsync(ctx, service)
+	waitListening(t, adminAddr(service))
+	if status := getStatus(t, "http://"+adminAddr(service)+"/healthz"); status != fiber.StatusOK {
+		t.Fatalf("status=%d", status)
+	}
+	cancel()
+	assertCleanExit(t, waitRun(t, done), ExitReasonContextDone)
+}
+
+// 运维端口监听失败时 Start 返回的 channel 中应有错误,Run 以 ExitReasonServerStopped 退出
+func TestAdminListenFailure(t *testing.T) {
+	service := newTestService(t, withAdmin)
+	l, err := net.Listen("tcp4", adminAddr(service))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	err = waitRun(t, runAsync(context.Background(), service))
+	var exitErr *ExitError
+	if !es.As(err, &exitErr) || exitErr.Reason != ExitReasonServerStopped || exitErr.Err == nil {
+		t.Fatalf("运维端口启动失败时 Run 应返回错误, got %v", err)
+	}
+}
+
+// 主服务监听失败时运维端口同时关闭
+func TestAdminStopsWithMainServer(t *testing.T) {
+	service := newTestService(t, withAdmin)
+	l, err := net.Listen("tcp4", service.GetServerAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	select {
+	case err := <-service.Start(nil):
+		if err == nil {
+			t.Fatal("主服务监听失败时应返回错误")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start 没有返回错误")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.DialTimeout("tcp", adminAddr(service), 100*time.Millisecond)
+		if err != nil {
+			return
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("运维端口没有关闭")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -1,106 +1,205 @@
 package httpx
 
-//var (
-//	BindingProtoBuf      = protobufBinding{}
-//	BindingJSON          = jsonBinding{}
-//	BindingXML           = binding.XML
-//	BindingForm          = binding.Form
-//	BindingQuery         = binding.Query
-//	BindingFormPost      = binding.FormPost
-//	BindingFormMultipart = binding.FormMultipart
-//	BindingMsgPack       = binding.MsgPack
-//	BindingYAML          = binding.YAML
-//	BindingUri           = binding.Uri
-//)
-//
-//func Bind(c *gin.Context, obj interface{}) error {
-//	return c.ShouldBindWith(obj, GetBinding(c))
-//}
-//
-//func GetBinding(c *gin.Context) binding.Binding {
-//	method, contentType := c.Request.Method, c.ContentType()
-//	if method == "GET" {
-//		return BindingForm
-//	}
-//
-//	switch contentType {
-//	case binding.MIMEJSON:
-//		return BindingJSON
-//	case binding.MIMEXML, binding.MIMEXML2:
-//		return BindingXML
-//	case binding.MIMEPROTOBUF:
-//		return BindingProtoBuf
-//	case binding.MIMEMSGPACK, binding.MIMEMSGPACK2:
-//		return BindingMsgPack
-//	case binding.MIMEYAML:
-//		return BindingYAML
-//	default: // case MIMEPOSTForm, MIMEMultipartPOSTForm:
-//		return BindingForm
-//	}
-//}
-//
-//type protobufBinding struct{}
-//
-//func (protobufBinding) Name() string {
-//	return "protobuf"
-//}
-//
-//func (b protobufBinding) Bind(req *http.Request, obj interface{}) error {
-//	buf, err := io.ReadAll(req.Body)
-//	if err != nil {
-//		return err
-//	}
-//	return b.BindBody(buf, obj)
-//}
-//
-//func (protobufBinding) BindBody(body []byte, obj interface{}) error {
-//	if err := proto.Unmarshal(body, obj.(proto.Message)); err != nil {
-//		return err
-//	}
-//	// Here it's same to return validate(obj), but util now we can't add
-//	// `binding:""` to the struct which automatically generate by gen-proto
-//	return nil
-//	// return validate(obj)
-//}
-//
-//// EnableDecoderUseNumber is used to call the UseNumber method on the JSON
-//// Decoder instance. UseNumber causes the Decoder to unmarshal a number into an
-//// interface{} as a Number instead of as a float64.
-//var EnableDecoderUseNumber = false
-//
-//var json = jsoniter.ConfigCompatibleWithStandardLibrary
-//
-//type jsonBinding struct{}
-//
-//func (jsonBinding) Name() string {
-//	return "json"
-//}
-//
-//func (jsonBinding) Bind(req *http.Request, obj interface{}) error {
-//	if req == nil || req.Body == nil {
-//		return fmt.Errorf("invalid request")
-//	}
-//	return decodeJSON(req.Body, obj)
-//}
-//
-//func (jsonBinding) BindBody(body []byte, obj interface{}) error {
-//	return decodeJSON(bytes.NewReader(body), obj)
-//}
-//
-//func decodeJSON(r io.Reader, obj interface{}) error {
-//	decoder := json.NewDecoder(r)
-//	if EnableDecoderUseNumber {
-//		decoder.UseNumber()
-//	}
-//	if err := decoder.Decode(obj); err != nil {
-//		return err
-//	}
-//	return validate(obj)
-//}
-//
-//func validate(obj interface{}) error {
-//	if binding.Validator == nil {
-//		return nil
-//	}
-//	return binding.Validator.ValidateStruct(obj)
-//}
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	es "errors"
+	"github.com/coffeehc/base/errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+	"io"
+	"strings"
+)
+
+const (
+	MIMEPROTOBUF  = "application/x-protobuf"
+	MIMEMSGPACK   = "application/x-msgpack"
+	MIMEMSGPACK2  = "application/msgpack"
+	MIMEYAML      = "application/x-yaml"
+	MIMEYAML2     = "application/yaml"
+	MIMEPOSTForm  = fiber.MIMEApplicationForm
+	MIMEMultipart = fiber.MIMEMultipartForm
+)
+
+// Binding 将请求内容解析到 obj
+type Binding interface {
+	Name() string
+	Bind(c *fiber.Ctx, obj interface{}) error
+}
+
+var (
+	BindingProtoBuf      Binding = protobufBinding{}
+	BindingJSON          Binding = jsonBinding{}
+	BindingXML           Binding = xmlBinding{}
+	BindingForm          Binding = formBinding{}
+	BindingQuery         Binding = queryBinding{}
+	BindingFormPost      Binding = formBinding{}
+	BindingFormMultipart Binding = formBinding{}
+	BindingMsgPack       Binding = msgpackBinding{}
+	BindingYAML          Binding = yamlBinding{}
+)
+
+// EnableDecoderUseNumber 为 true 时 JSON 中的数字解析到 interface{} 时使用 json.Number 而不是 float64
+var EnableDecoderUseNumber = false
+
+// Bind 根据请求方法和 Content-Type 选择 Binding 解析请求,解析后使用 Validator 校验
+func Bind(c *fiber.Ctx, obj interface{}) error {
+	if err := GetBinding(c).Bind(c, obj); err != nil {
+		return err
+	}
+	return validate(obj)
+}
+
+// GetBinding GET 请求和没有请求体的请求(如 DELETE、HEAD)使用 BindingQuery,其它请求按 Content-Type 选择
+func GetBinding(c *fiber.Ctx) Binding {
+	if c.Method() == fiber.MethodGet || len(c.Body()) == 0 {
+		return BindingQuery
+	}
+	switch contentType(c) {
+	case fiber.MIMEApplicationJSON:
+		return BindingJSON
+	case fiber.MIMEApplicationXML, fiber.MIMETextXML:
+		return BindingXML
+	case MIMEPROTOBUF:
+		return BindingProtoBuf
+	case MIMEMSGPACK, MIMEMSGPACK2:
+		return BindingMsgPack
+	case MIMEYAML, MIMEYAML2:
+		return BindingYAML
+	case MIMEMultipart:
+		return BindingFormMultipart
+	default: // case MIMEPOSTForm:
+		return BindingForm
+	}
+}
+
+// contentType 返回不带参数的 Content-Type
+func contentType(c *fiber.Ctx) string {
+	ct := c.Get(fiber.HeaderContentType)
+	if i := strings.IndexByte(ct, ';'); i >= 0 {
+		ct = ct[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(ct))
+}
+
+type protobufBinding struct{}
+
+func (protobufBinding) Name() string {
+	return "protobuf"
+}
+
+func (protobufBinding) Bind(c *fiber.Ctx, obj interface{}) error {
+	msg, ok := obj.(proto.Message)
+	if !ok {
+		return errors.SystemError("protobuf绑定的对象必须是proto.Message")
+	}
+	return decodeError(proto.Unmarshal(c.Body(), msg))
+}
+
+type jsonBinding struct{}
+
+func (jsonBinding) Name() string {
+	return "json"
+}
+
+func (jsonBinding) Bind(c *fiber.Ctx, obj interface{}) error {
+	return decodeError(decodeJSON(c.Body(), obj))
+}
+
+// errTrailingData 请求体在解析出一个值之后还有多余的内容
+var errTrailingData = fiber.NewError(fiber.StatusBadRequest, "请求体存在多余内容")
+
+// decodeError 将请求内容解析失败转换为400,与绑定对象类型不匹配等服务端错误不经过这里,按500处理
+func decodeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var fiberErr *fiber.Error
+	if es.As(err, &fiberErr) {
+		return err
+	}
+	return fiber.NewError(fiber.StatusBadRequest, "请求内容解析失败: "+err.Error())
+}
+
+func decodeJSON(body []byte, obj interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if EnableDecoderUseNumber {
+		decoder.UseNumber()
+	}
+	if err := decoder.Decode(obj); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errTrailingData
+	}
+	return nil
+}
+
+type xmlBinding struct{}
+
+func (xmlBinding) Name() string {
+	return "xml"
+}
+
+func (xmlBinding) Bind(c *fiber.Ctx, obj interface{}) error {
+	return decodeError(xml.Unmarshal(c.Body(), obj))
+}
+
+// formBinding 解析 application/x-www-form-urlencoded 和 multipart/form-data,结构体使用 form 标签,
+// 与 gin 的表单绑定一致同时读取 URL 参数,请求体中的同名字段优先
+type formBinding struct{}
+
+func (formBinding) Name() string {
+	return "form"
+}
+
+func (formBinding) Bind(c *fiber.Ctx, obj interface{}) error {
+	if err := bindValues(obj, TagForm, queryValues(c)); err != nil {
+		return err
+	}
+	return decodeError(c.BodyParser(obj))
+}
+
+// queryBinding 解析 URL 参数,结构体使用 query 标签,类型转换规则见 BindQuery
+type queryBinding struct{}
+
+func (queryBinding) Name() string {
+	return "query"
+}
+
+func (queryBinding) Bind(c *fiber.Ctx, obj interface{}) error {
+	return BindQuery(c, obj)
+}
+
+// msgpackBinding 解析 MessagePack,结构体优先使用 msgpack 标签,没有时使用 json 标签
+type msgpackBinding struct{}
+
+func (msgpackBinding) Name() string {
+	return "msgpack"
+}
+
+func (msgpackBinding) Bind(c *fiber.Ctx, obj interface{}) error {
+	reader := bytes.NewReader(c.Body())
+	decoder := msgpack.NewDecoder(reader)
+	decoder.SetCustomStructTag("json")
+	if err := decoder.Decode(obj); err != nil {
+		return decodeError(err)
+	}
+	if reader.Len() != 0 {
+		return errTrailingData
+	}
+	return nil
+}
+
+type yamlBinding struct{}
+
+func (yamlBinding) Name() string {
+	return "yaml"
+}
+
+func (yamlBinding) Bind(c *fiber.Ctx, obj interface{}) error {
+	return decodeError(yaml.Unmarshal(c.Body(), obj))
+}
@@ -0,0 +1,179 @@
+package httpx
+
+import (
+	"bytes"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"github.com/gofiber/fiber/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type msgpackPayload struct {
+	Name    string           `json:"name"`
+	Data    []byte           `msgpack:"data"`
+	Created time.Time        `json:"created"`
+	Scores  map[int]string   `json:"scores"`
+	Extra   map[string]int64 `json:"extra"`
+}
+
+// bindBody 使用 Bind 解析 POST 请求体,返回处理器的错误
+func bindBody(t *testing.T, contentType string, body []byte, obj interface{}) error {
+	t.Helper()
+	return bindRequest(t, fiber.MethodPost, "/", contentType, body, obj)
+}
+
+// bindRequest 使用 Bind 解析请求,contentType 为空时不设置 Content-Type
+func bindRequest(t *testing.T, method, target, contentType string, body []byte, obj interface{}) error {
+	t.Helper()
+	app := fiber.New()
+	var bindErr error
+	app.Add(method, "/", func(c *fiber.Ctx) error {
+		bindErr = Bind(c, obj)
+		return nil
+	})
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	if contentType != "" {
+		req.Header.Set(fiber.HeaderContentType, contentType)
+	}
+	if _, err := app.Test(req); err != nil {
+		t.Fatal(err)
+	}
+	return bindErr
+}
+
+type bindPayload struct {
+	Name  string `json:"name" xml:"name" yaml:"name" form:"name" query:"name"`
+	Count int    `json:"count" xml:"count" yaml:"count" form:"count" query:"count"`
+}
+
+func TestBindDispatch(t *testing.T) {
+	multipartData, multipartType := multipartBody(t, uploadPart{field: "name", data: []byte("httpx")}, uploadPart{field: "count", data: []byte("3")})
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"json", fiber.MIMEApplicationJSON + "; charset=utf-8", `{"name":"httpx","count":3}`},
+		{"xml", fiber.MIMEApplicationXML, `<bindPayload><name>httpx</name><count>3</count></bindPayload>`},
+		{"text/xml", fiber.MIMETextXML, `<bindPayload><name>httpx</name><count>3</count></bindPayload>`},
+		{"yaml", MIMEYAML, "name: httpx\ncount: 3\n"},
+		{"yaml2", MIMEYAML2, "name: httpx\ncount: 3\n"},
+		{"form", MIMEPOSTForm, "name=httpx&count=3"},
+		{"multipart", multipartType, string(multipartData)},
+	}
+	for _, tc := range cases {
+		obj := &bindPayload{}
+		if err := bindBody(t, tc.contentType, []byte(tc.body), obj); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if obj.Name != "httpx" || obj.Count != 3 {
+			t.Fatalf("%s: got %+v", tc.name, obj)
+		}
+	}
+}
+
+func TestBindProtobuf(t *testing.T) {
+	body, err := proto.Marshal(&httpxcommons.FieldError{Field: "name", Rule: "required"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &httpxcommons.FieldError{}
+	if err := bindBody(t, MIMEPROTOBUF, body, msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.GetField() != "name" || msg.GetRule() != "required" {
+		t.Fatalf("got %v", msg)
+	}
+	if err := bindBody(t, MIMEPROTOBUF, body, &bindPayload{}); err == nil {
+		t.Fatal("绑定到非 proto.Message 时应返回错误")
+	}
+}
+
+// GET 和没有请求体的请求读取 URL 参数,不因为缺少 Content-Type 失败
+func TestBindQuery(t *testing.T) {
+	for _, method := range []string{fiber.MethodGet, fiber.MethodDelete, fiber.MethodPost} {
+		obj := &bindPayload{}
+		if err := bindRequest(t, method, "/?name=httpx&count=3", "", nil, obj); err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		if obj.Name != "httpx" || obj.Count != 3 {
+			t.Fatalf("%s: got %+v", method, obj)
+		}
+	}
+}
+
+// 表单绑定同时读取 URL 参数,请求体中的同名字段优先
+func TestBindFormWithQuery(t *testing.T) {
+	obj := &bindPayload{}
+	if err := bindRequest(t, fiber.MethodPost, "/?name=query&count=3", MIMEPOSTForm, []byte("name=body"), obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj.Name != "body" || obj.Count != 3 {
+		t.Fatalf("got %+v", obj)
+	}
+}
+
+func TestBindJSONTrailingData(t *testing.T) {
+	if err := bindBody(t, fiber.MIMEApplicationJSON, []byte(`{"name":"httpx"}  `), &bindPayload{}); err != nil {
+		t.Fatalf("末尾的空白应被忽略: %v", err)
+	}
+	for _, body := range []string{`{"name":"httpx"}{"name":"x"}`, `{"name":"httpx"} 1`} {
+		if err := bindBody(t, fiber.MIMEApplicationJSON, []byte(body), &bindPayload{}); err != errTrailingData {
+			t.Fatalf("%s: 存在多余内容时应返回错误, got %v", body, err)
+		}
+	}
+}
+
+func TestBindMsgPack(t *testing.T) {
+	created := time.Date(2024, 5, 1, 8, 30, 0, 123456789, time.UTC)
+	body, err := msgpack.Marshal(map[string]interface{}{
+		"name":    "httpx",
+		"data":    []byte{0x00, 0xff, 0x10},
+		"created": created,
+		"scores":  map[int]string{1: "a", 2: "b"},
+		"extra":   map[string]int64{"big": 1 << 60},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, contentType := range []string{MIMEMSGPACK, MIMEMSGPACK2} {
+		obj := &msgpackPayload{}
+		if err := bindBody(t, contentType, body, obj); err != nil {
+			t.Fatalf("%s: %v", contentType, err)
+		}
+		if obj.Name != "httpx" {
+			t.Fatalf("name = %q", obj.Name)
+		}
+		if !bytes.Equal(obj.Data, []byte{0x00, 0xff, 0x10}) {
+			t.Fatalf("bin 数据应原样解析, got %v", obj.Data)
+		}
+		if !obj.Created.Equal(created) {
+			t.Fatalf("timestamp 扩展类型解析错误, got %v", obj.Created)
+		}
+		if obj.Scores[1] != "a" || obj.Scores[2] != "b" {
+			t.Fatalf("整数键解析错误, got %v", obj.Scores)
+		}
+		if obj.Extra["big"] != 1<<60 {
+			t.Fatalf("大整数精度丢失, got %v", obj.Extra["big"])
+		}
+	}
+}
+
+func TestBindMsgPackInvalid(t *testing.T) {
+	body, err := msgpack.Marshal(map[string]interface{}{"name": "httpx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bindBody(t, MIMEMSGPACK, append(body, 0xc0), &msgpackPayload{}); err == nil {
+		t.Fatal("存在多余内容时应返回错误")
+	}
+	if err := bindBody(t, MIMEMSGPACK, append(body, 0xc0), &msgpackPayload{}); err != errTrailingData {
+		t.Fatalf("多余内容的错误应与 JSON 一致, got %v", err)
+	}
+	if err := bindBody(t, MIMEMSGPACK, body[:len(body)-2], &msgpackPayload{}); err == nil {
+		t.Fatal("数据不完整时应返回错误")
+	}
+}
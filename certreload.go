@@ -0,0 +1,173 @@
+package httpx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/coffeehc/base/errors"
+	"github.com/coffeehc/base/log"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertificateSource 在TLS握手时提供服务端证书
+type CertificateSource interface {
+	GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
+}
+
+// CertificateReloader 监听磁盘上的PEM证书文件,文件变化后重新加载并在校验通过后替换正在使用的证书
+type CertificateReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mutex    sync.RWMutex
+	cert     *tls.Certificate
+	leaf     *x509.Certificate
+	modTimes []time.Time
+	onReload []func(cert tls.Certificate)
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewCertificateReloader 创建证书热加载器,keyFile 为空时认为私钥与证书在同一个PEM文件中,
+// interval 为检查文件变化的间隔,小于等于0时默认为10秒
+func NewCertificateReloader(certFile, keyFile string, interval time.Duration) (*CertificateReloader, error) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	r := &CertificateReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	go r.watch()
+	return r, nil
+}
+
+func (r *CertificateReloader) files() []string {
+	if r.keyFile == "" {
+		return []string{r.certFile}
+	}
+	return []string{r.certFile, r.keyFile}
+}
+
+func (r *CertificateReloader) statModTimes() ([]time.Time, error) {
+	files := r.files()
+	modTimes := make([]time.Time, 0, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+	return modTimes, nil
+}
+
+// Reload 立即从磁盘重新加载证书,校验失败时继续使用原证书
+func (r *CertificateReloader) Reload() error {
+	modTimes, err := r.statModTimes()
+	if err != nil {
+		return err
+	}
+	var raw []byte
+	for _, file := range r.files() {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		raw = append(raw, data...)
+		raw = append(raw, '\n')
+	}
+	cert, err := httpxcommons.LoadCertificate(raw)
+	if err != nil {
+		return err
+	}
+	leaf := cert.Leaf
+	if time.Now().After(leaf.NotAfter) {
+		return errors.SystemError(fmt.Sprintf("证书已过期,过期时间%s", leaf.NotAfter.Format(time.RFC3339)))
+	}
+	r.mutex.Lock()
+	r.cert = &cert
+	r.leaf = leaf
+	r.modTimes = modTimes
+	onReload := r.onReload
+	r.mutex.Unlock()
+	log.Info("加载TLS证书", zap.String("file", r.certFile), zap.Strings("dns_names", leaf.DNSNames), zap.Time("not_after", leaf.NotAfter))
+	for _, fn := range onReload {
+		fn(cert)
+	}
+	return nil
+}
+
+// OnReload 注册证书重新加载成功后的回调,回调在替换证书之后执行
+func (r *CertificateReloader) OnReload(fn func(cert tls.Certificate)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.onReload = append(r.onReload, fn)
+}
+
+func (r *CertificateReloader) changed() bool {
+	modTimes, err := r.statModTimes()
+	if err != nil {
+		log.Error("检查TLS证书文件失败", zap.String("file", r.certFile), zap.Error(err))
+		return false
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for i, modTime := range modTimes {
+		if !modTime.Equal(r.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *CertificateReloader) watch() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				log.Error("重新加载TLS证书失败,继续使用原证书", zap.String("file", r.certFile), zap.Error(err))
+			}
+		}
+	}
+}
+
+// GetCertificate 实现 CertificateSource,可直接设置到 tls.Config.GetCertificate
+func (r *CertificateReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.cert, nil
+}
+
+// NotAfter 返回当前使用证书的过期时间
+func (r *CertificateReloader) NotAfter() time.Time {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.leaf.NotAfter
+}
+
+// Close 停止监听证书文件
+func (r *CertificateReloader) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.stop)
+	})
+	return nil
+}
@@ -0,0 +1,187 @@
+package httpx
+
+import (
+	"crypto/tls"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeCertFiles 写入证书和私钥并设置修改时间,保证每次写入都能被检测到
+func writeCertFiles(t *testing.T, cert tls.Certificate, certFile, keyFile string, modTime time.Time) {
+	t.Helper()
+	if err := httpxcommons.WriteCertificatePEM(cert, certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func currentName(t *testing.T, r *CertificateReloader) string {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Leaf.DNSNames[0]
+}
+
+func waitCertificate(t *testing.T, r *CertificateReloader, name string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for currentName(t, r) != name {
+		if time.Now().After(deadline) {
+			t.Fatalf("证书没有更新为 %s, got %s", name, currentName(t, r))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCertificateReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if _, err := NewCertificateReloader(certFile, keyFile, time.Millisecond); err == nil {
+		t.Fatal("证书文件不存在时应返回错误")
+	}
+	modTime := time.Now().Add(-time.Hour)
+	writeCertFiles(t, generateCertificate(t, "a.example.com"), certFile, keyFile, modTime)
+	r, err := NewCertificateReloader(certFile, keyFile, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var mutex sync.Mutex
+	var reloaded []string
+	r.OnReload(func(cert tls.Certificate) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		reloaded = append(reloaded, cert.Leaf.DNSNames[0])
+	})
+	if name := currentName(t, r); name != "a.example.com" {
+		t.Fatalf("got %s", name)
+	}
+
+	// 文件变化后自动重新加载
+	modTime = modTime.Add(time.Minute)
+	certB := generateCertificate(t, "b.example.com")
+	writeCertFiles(t, certB, certFile, keyFile, modTime)
+	waitCertificate(t, r, "b.example.com")
+	if !r.NotAfter().Equal(certB.Leaf.NotAfter) {
+		t.Fatalf("NotAfter=%s", r.NotAfter())
+	}
+	mutex.Lock()
+	if len(reloaded) != 1 || reloaded[0] != "b.example.com" {
+		t.Fatalf("OnReload 应在重新加载后调用, got %v", reloaded)
+	}
+	mutex.Unlock()
+
+	// 文件内容无效或证书已过期时继续使用原证书
+	modTime = modTime.Add(time.Minute)
+	if err := os.WriteFile(certFile, []byte("invalid"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(certFile, modTime, modTime)
+	if err := r.Reload(); err == nil {
+		t.Fatal("证书无效时 Reload 应返回错误")
+	}
+	expired, err := httpxcommons.GenerateSelfSignedCertificate(httpxcommons.SelfSignedOptions{Hosts: []string{"expired.example.com"}, Validity: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeCertFiles(t, expired, certFile, keyFile, modTime.Add(time.Minute))
+	if err := r.Reload(); err == nil {
+		t.Fatal("证书已过期时 Reload 应返回错误")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if name := currentName(t, r); name != "b.example.com" {
+		t.Fatalf("重新加载失败时应继续使用原证书, got %s", name)
+	}
+
+	// Close 后不再检查文件变化
+	r.Close()
+	r.Close()
+	time.Sleep(20 * time.Millisecond)
+	writeCertFiles(t, generateCertificate(t, "c.example.com"), certFile, keyFile, modTime.Add(2*time.Minute))
+	time.Sleep(50 * time.Millisecond)
+	if name := currentName(t, r); name != "b.example.com" {
+		t.Fatalf("Close 后不应重新加载, got %s", name)
+	}
+}
+
+// 证书和私钥在同一个文件中
+func TestCertificateReloaderBundle(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tls.pem")
+	if err := httpxcommons.WriteCertificatePEM(generateCertificate(t, "a.example.com"), file, ""); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewCertificateReloader(file, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if name := currentName(t, r); name != "a.example.com" {
+		t.Fatalf("got %s", name)
+	}
+}
+
+// 使用 CertificateReloader 启动时 GetCertificateInfo 返回当前证书,重新加载后更新
+func TestStartWithCertificateSourceInfo(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	modTime := time.Now().Add(-time.Hour)
+	writeCertFiles(t, generateCertificate(t, "127.0.0.1"), certFile, keyFile, modTime)
+	r, err := NewCertificateReloader(certFile, keyFile, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := newTestService(t)
+	service.StartWithCertificateSource(r, nil)
+	defer service.Shutdown()
+	info := service.GetCertificateInfo()
+	if info == nil || len(info.IPAddresses) != 1 || info.IPAddresses[0] != "127.0.0.1" {
+		t.Fatalf("got %+v", info)
+	}
+	writeCertFiles(t, generateCertificate(t, "localhost"), certFile, keyFile, modTime.Add(time.Minute))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if info := service.GetCertificateInfo(); len(info.DNSNames) == 1 && info.DNSNames[0] == "localhost" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("证书信息没有更新, got %+v", service.GetCertificateInfo())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// 服务关闭时同时关闭 CertificateReloader
+	service.Shutdown()
+	select {
+	case <-r.stop:
+	case <-time.After(5 * time.Second):
+		t.Fatal("服务关闭后应关闭 CertificateReloader")
+	}
+}
+
+// 证书剩余有效期小于 CertExpiryWarningDays(默认30天)时需要告警
+func TestCertificateExpiryWarning(t *testing.T) {
+	cert, err := httpxcommons.GenerateSelfSignedCertificate(httpxcommons.SelfSignedOptions{Hosts: []string{"127.0.0.1"}, Validity: 10 * 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for days, expiring := range map[int]bool{0: true, 5: false, 11: true} {
+		service := newTestService(t, func(config *Config) {
+			config.CertExpiryWarningDays = days
+		})
+		service.StartWithCertificate(cert, nil)
+		info := service.GetCertificateInfo()
+		if info == nil || info.IsExpiringWithin(service.(*serviceImpl).config.getCertExpiryWarning()) != expiring {
+			t.Fatalf("CertExpiryWarningDays=%d: info=%+v", days, info)
+		}
+		service.Shutdown()
+	}
+}
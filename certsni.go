@@ -0,0 +1,118 @@
+package httpx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/coffeehc/base/errors"
+	"github.com/coffeehc/base/log"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SNICertificates 按 SNI 的服务器名称选择证书,没有匹配时使用默认证书
+type SNICertificates struct {
+	mutex       sync.RWMutex
+	certs       map[string]*tls.Certificate
+	defaultCert *tls.Certificate
+}
+
+func NewSNICertificates() *SNICertificates {
+	return &SNICertificates{certs: make(map[string]*tls.Certificate)}
+}
+
+// Add 添加证书,serverNames 为空时使用证书中的 DNSNames 和 CommonName,支持 *.example.com 通配符,
+// 第一个添加的证书同时作为默认证书
+func (s *SNICertificates) Add(cert tls.Certificate, serverNames ...string) error {
+	if cert.Leaf == nil {
+		if len(cert.Certificate) == 0 {
+			return errors.SystemError("证书链为空")
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return err
+		}
+		cert.Leaf = leaf
+	}
+	if len(serverNames) == 0 {
+		serverNames = append(serverNames, cert.Leaf.DNSNames...)
+		if len(serverNames) == 0 && cert.Leaf.Subject.CommonName != "" {
+			serverNames = append(serverNames, cert.Leaf.Subject.CommonName)
+		}
+	}
+	if len(serverNames) == 0 {
+		return errors.SystemError("证书没有可用的服务器名称")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, name := range serverNames {
+		s.certs[strings.ToLower(name)] = &cert
+	}
+	if s.defaultCert == nil {
+		s.defaultCert = &cert
+	}
+	return nil
+}
+
+// SetDefault 设置没有匹配到服务器名称时使用的证书
+func (s *SNICertificates) SetDefault(cert tls.Certificate) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.defaultCert = &cert
+}
+
+// GetCertificate 实现 CertificateSource
+func (s *SNICertificates) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name != "" {
+		if cert, ok := s.certs[name]; ok {
+			return cert, nil
+		}
+		if i := strings.IndexByte(name, '.'); i > 0 {
+			if cert, ok := s.certs["*"+name[i:]]; ok {
+				return cert, nil
+			}
+		}
+	}
+	if s.defaultCert == nil {
+		return nil, errors.SystemError("没有匹配的证书")
+	}
+	return s.defaultCert, nil
+}
+
+// LoadSNICertificatesFromDir 从目录中加载所有 .pem 证书包(证书和私钥在同一个文件中),
+// 文件名为 default.pem 的证书作为默认证书
+func LoadSNICertificatesFromDir(dir string) (*SNICertificates, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, errors.SystemError("目录中没有PEM证书")
+	}
+	s := NewSNICertificates()
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := httpxcommons.LoadCertificate(raw)
+		if err != nil {
+			log.Error("加载证书失败", zap.String("file", file), zap.Error(err))
+			return nil, err
+		}
+		if filepath.Base(file) == "default.pem" {
+			s.SetDefault(cert)
+		}
+		if err := s.Add(cert); err != nil {
+			log.Error("加载证书失败", zap.String("file", file), zap.Error(err))
+			return nil, err
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,101 @@
+package httpx
+
+import (
+	"crypto/tls"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"path/filepath"
+	"testing"
+)
+
+// sniName 返回 GetCertificate 为 serverName 选择的证书的第一个名称,没有证书时返回空
+func sniName(t *testing.T, s *SNICertificates, serverName string) string {
+	t.Helper()
+	cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	if err != nil {
+		return ""
+	}
+	if len(cert.Leaf.DNSNames) > 0 {
+		return cert.Leaf.DNSNames[0]
+	}
+	return cert.Leaf.Subject.CommonName
+}
+
+func TestSNICertificates(t *testing.T) {
+	s := NewSNICertificates()
+	if _, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: "a.example.com"}); err == nil {
+		t.Fatal("没有证书时应返回错误")
+	}
+	certA := generateCertificate(t, "a.example.com")
+	// 没有 Leaf 时从证书链中解析
+	certA.Leaf = nil
+	for _, cert := range []tls.Certificate{certA, generateCertificate(t, "b.example.com"), generateCertificate(t, "*.example.org")} {
+		if err := s.Add(cert); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Add(generateCertificate(t, "named.example.net"), "alias.example.net"); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"b.example.com":      "b.example.com",
+		"B.Example.COM.":     "b.example.com",
+		"x.example.org":      "*.example.org",
+		"a.x.example.org":    "a.example.com",
+		"example.org":        "a.example.com",
+		"alias.example.net":  "named.example.net",
+		"named.example.net":  "a.example.com",
+		"unknown.example.io": "a.example.com",
+		"":                   "a.example.com",
+	}
+	for serverName, want := range cases {
+		if got := sniName(t, s, serverName); got != want {
+			t.Fatalf("%q: got %q, want %q", serverName, got, want)
+		}
+	}
+	s.SetDefault(generateCertificate(t, "fallback.example.com"))
+	if got := sniName(t, s, "unknown.example.io"); got != "fallback.example.com" {
+		t.Fatalf("SetDefault 后应使用新的默认证书, got %q", got)
+	}
+}
+
+func TestSNICertificatesAddInvalid(t *testing.T) {
+	s := NewSNICertificates()
+	if err := s.Add(tls.Certificate{}); err == nil {
+		t.Fatal("空证书应返回错误")
+	}
+	if err := s.Add(tls.Certificate{Certificate: [][]byte{[]byte("invalid")}}); err == nil {
+		t.Fatal("无法解析的证书应返回错误")
+	}
+	if _, err := s.GetCertificate(&tls.ClientHelloInfo{}); err == nil {
+		t.Fatal("添加失败的证书不应作为默认证书")
+	}
+}
+
+func TestLoadSNICertificatesFromDir(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadSNICertificatesFromDir(dir); err == nil {
+		t.Fatal("目录中没有证书时应返回错误")
+	}
+	// a.pem 先加载,default.pem 仍然作为默认证书
+	files := map[string]string{"a.pem": "a.example.com", "default.pem": "fallback.example.com", "z.pem": "*.example.org"}
+	for file, host := range files {
+		if err := httpxcommons.WriteCertificatePEM(generateCertificate(t, host), filepath.Join(dir, file), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := LoadSNICertificatesFromDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"a.example.com":        "a.example.com",
+		"x.example.org":        "*.example.org",
+		"fallback.example.com": "fallback.example.com",
+		"unknown.example.io":   "fallback.example.com",
+	}
+	for serverName, want := range cases {
+		if got := sniName(t, s, serverName); got != want {
+			t.Fatalf("%q: got %q, want %q", serverName, got, want)
+		}
+	}
+}
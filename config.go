@@ -2,6 +2,7 @@ package httpx
 
 import (
 	"crypto/tls"
+	"github.com/coffeehc/base/errors"
 	"github.com/gofiber/fiber/v2"
 	"net"
 	"net/http"
@@ -22,11 +23,22 @@ type Config struct {
 	TLSNextProto map[string]func(*http.Server, *tls.Conn, http.Handler)
 	ConnState    func(net.Conn, http.ConnState)
 
+	// ClientCAFile 客户端CA证书包(PEM)路径,配置后以mTLS方式校验客户端证书,
+	// TLSConfig.ClientAuth 未设置时要求客户端必须提供证书,设置为 VerifyClientCertIfGiven 时客户端证书可选
+	ClientCAFile string `mapstructure:"client_ca_file,omitempty" json:"client_ca_file,omitempty"`
+	// CertExpiryWarningDays 证书剩余有效期小于该天数时输出警告日志,默认30天
+	CertExpiryWarningDays int `mapstructure:"cert_expiry_warning_days,omitempty" json:"cert_expiry_warning_days,omitempty"`
+
 	AppName        string `mapstructure:"app_name,omitempty" json:"app_name,omitempty"`
 	ServerAddr     string `mapstructure:"server_addr,omitempty" json:"server_addr,omitempty"`
 	ReadTimeoutMs  int64  `mapstructure:"read_timeout_ms,omitempty" json:"read_timeout_ms,omitempty"`
 	WriteTimeoutMs int64  `mapstructure:"write_timeout_ms,omitempty" json:"write_timeout_ms,omitempty"`
 	IdleTimeoutMs  int64  `mapstructure:"idle_timeout_ms,omitempty" json:"idle_timeout_ms,omitempty"`
+	// ShutdownTimeoutMs 优雅关闭时等待进行中请求结束的最长时间,超时后强制关闭剩余连接
+	ShutdownTimeoutMs int64 `mapstructure:"shutdown_timeout_ms,omitempty" json:"shutdown_timeout_ms,omitempty"`
+	// ShutdownDelayMs 关闭时先让 /readyz 返回失败,等待该时间后再关闭监听,便于负载均衡摘除流量。
+	// 只在开启 EnableHealthCheck 时生效,默认为5000ms,应不小于负载均衡健康检查的间隔乘以失败阈值,小于0时不等待
+	ShutdownDelayMs int64 `mapstructure:"shutdown_delay_ms,omitempty" json:"shutdown_delay_ms,omitempty"`
 
 	ReadBufferSize  int `mapstructure:"read_buffer_size,omitempty" json:"read_buffer_size,omitempty"`
 	WriteBufferSize int `mapstructure:"write_buffer_size,omitempty" json:"write_buffer_size,omitempty"`
@@ -61,10 +73,41 @@ type Config struct {
 	EnableIPValidation           bool     `mapstructure:"enable_ip_validation,omitempty" json:"enable_ip_validation,omitempty"`
 	EnablePrintRoutes            bool     `mapstructure:"enable_print_routes,omitempty" json:"enable_print_routes,omitempty"`
 
-	Views        fiber.Views `json:"-"`
+	// RequestIDHeader 请求ID使用的请求头,默认为 X-Request-ID
+	RequestIDHeader string `mapstructure:"request_id_header,omitempty" json:"request_id_header,omitempty"`
+	// DisableRequestID 不自动挂载 RequestIDMiddleware
+	DisableRequestID bool `mapstructure:"disable_request_id,omitempty" json:"disable_request_id,omitempty"`
+	// AdminAddr 运维端口地址,配置后 pprof 等运维接口挂载在该端口上,与主服务一起启动和关闭
+	AdminAddr string `mapstructure:"admin_addr,omitempty" json:"admin_addr,omitempty"`
+	// Pprof 开启后挂载 pprof 接口,配置了 AdminAddr 时挂载在运维端口上
+	Pprof *PprofConfig `mapstructure:"pprof,omitempty" json:"pprof,omitempty"`
+	// EnableMetrics 开启后统计请求指标并挂载 /metrics,配置了 AdminAddr 时挂载在运维端口上
+	EnableMetrics bool `mapstructure:"enable_metrics,omitempty" json:"enable_metrics,omitempty"`
+	// EnableHealthCheck 开启后挂载 /healthz、/readyz、/livez、/startupz,配置了 AdminAddr 时挂载在运维端口上
+	EnableHealthCheck bool `mapstructure:"enable_health_check,omitempty" json:"enable_health_check,omitempty"`
+	// ManualStartup 为 true 时 /startupz 和 /readyz 在调用 GetHealthRegistry().SetStarted() 之前返回失败,
+	// 用于应用在启动监听后还需要预热的场景,为 false 时服务开始监听后自动标记为已启动
+	ManualStartup bool `mapstructure:"manual_startup,omitempty" json:"manual_startup,omitempty"`
+	// HealthCacheIntervalMs 健康检查结果的缓存时间,默认1000ms
+	HealthCacheIntervalMs int64 `mapstructure:"health_cache_interval_ms,omitempty" json:"health_cache_interval_ms,omitempty"`
+
+	Views fiber.Views `json:"-"`
+	// ErrorHandler 为空时使用 DefaultErrorHandler,访问日志、指标和链路追踪按 httpxcommons.MapError 记录错误的状态码,
+	// 自定义时应使用相同的错误转换规则
 	ErrorHandler fiber.ErrorHandler
 }
 
+// Validate 检查配置是否合法,NewService 时调用
+func (impl *Config) Validate() error {
+	if err := validateTLSConfig(impl.TLSConfig, impl.ClientCAFile != ""); err != nil {
+		return err
+	}
+	if impl.Prefork && (impl.TLSConfig != nil || len(impl.TLSNextProto) > 0 || impl.ClientCAFile != "") {
+		return errors.SystemError("Prefork模式不支持TLSConfig、TLSNextProto和ClientCAFile")
+	}
+	return nil
+}
+
 func (impl *Config) getBodyLimit() int {
 	if impl.BodyLimit == 0 {
 		impl.BodyLimit = 1024 * 1024 * 16
@@ -72,6 +115,13 @@ func (impl *Config) getBodyLimit() int {
 	return impl.BodyLimit
 }
 
+func (impl *Config) getErrorHandler() fiber.ErrorHandler {
+	if impl.ErrorHandler == nil {
+		impl.ErrorHandler = DefaultErrorHandler
+	}
+	return impl.ErrorHandler
+}
+
 func (impl *Config) getServerAddr() string {
 	if impl.ServerAddr == "" {
 		impl.ServerAddr = "0.0.0.0:8888"
@@ -99,3 +149,37 @@ func (impl *Config) getWriteTimeout() time.Duration {
 	}
 	return time.Duration(impl.WriteTimeoutMs) * time.Millisecond
 }
+
+func (impl *Config) getShutdownTimeout() time.Duration {
+	if impl.ShutdownTimeoutMs <= 0 {
+		impl.ShutdownTimeoutMs = 15000
+	}
+	return time.Duration(impl.ShutdownTimeoutMs) * time.Millisecond
+}
+
+func (impl *Config) getShutdownDelay() time.Duration {
+	if !impl.EnableHealthCheck {
+		return 0
+	}
+	if impl.ShutdownDelayMs == 0 {
+		impl.ShutdownDelayMs = 5000
+	}
+	if impl.ShutdownDelayMs < 0 {
+		return 0
+	}
+	return time.Duration(impl.ShutdownDelayMs) * time.Millisecond
+}
+
+func (impl *Config) getHealthCacheInterval() time.Duration {
+	if impl.HealthCacheIntervalMs <= 0 {
+		impl.HealthCacheIntervalMs = 1000
+	}
+	return time.Duration(impl.HealthCacheIntervalMs) * time.Millisecond
+}
+
+func (impl *Config) getCertExpiryWarning() time.Duration {
+	if impl.CertExpiryWarningDays <= 0 {
+		impl.CertExpiryWarningDays = 30
+	}
+	return time.Duration(impl.CertExpiryWarningDays) * 24 * time.Hour
+}
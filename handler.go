@@ -0,0 +1,42 @@
+package httpx
+
+import (
+	"context"
+	es "errors"
+	"github.com/coffeehc/base/log"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// Handle 将与传输层无关的业务函数适配为 fiber.Handler,
+// 请求按 BindAll 的规则解析并校验,函数使用 c.UserContext() 调用(因此 ContextTimeoutMiddleware 或 RecoverMiddleware 设置的超时生效),
+// 结果通过 httpxcommons.SendSuccess 输出,解析和业务函数的错误都通过 httpxcommons.SendMappedError 输出,
+// 请求内容格式错误和参数校验失败返回400,其它解析错误(如绑定对象类型不支持)按服务端错误处理
+func Handle[Req, Resp any](fn func(ctx context.Context, req *Req) (*Resp, error)) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req := new(Req)
+		if err := BindAll(c, req); err != nil {
+			return httpxcommons.SendMappedError(c, err)
+		}
+		resp, err := fn(c.UserContext(), req)
+		if err != nil {
+			return httpxcommons.SendMappedError(c, err)
+		}
+		return httpxcommons.SendSuccess(c, resp, 0)
+	}
+}
+
+// DefaultErrorHandler 未配置 Config.ErrorHandler 时使用,按 httpxcommons 的错误转换规则输出错误,
+// 处理器中直接 return err 即可
+func DefaultErrorHandler(c *fiber.Ctx, err error) error {
+	mapping := httpxcommons.MapError(err)
+	switch {
+	case mapping.StatusCode >= fiber.StatusInternalServerError:
+		log.Error("处理请求失败", zap.String("method", c.Method()), zap.String("path", c.Path()), zap.String("request_id", httpxcommons.GetRequestID(c)), zap.Error(err))
+	case es.Is(err, context.Canceled):
+		// 客户端主动断开不是服务端错误
+		log.Info("请求已取消", zap.String("method", c.Method()), zap.String("path", c.Path()), zap.String("request_id", httpxcommons.GetRequestID(c)))
+	}
+	return httpxcommons.SendMappedError(c, err)
+}
@@ -0,0 +1,124 @@
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	es "errors"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"github.com/gofiber/fiber/v2"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// callJSON 发送 JSON 请求并解析 AjaxResponse
+func callJSON(t *testing.T, app *fiber.App, method, target, contentType, body string) (int, *httpxcommons.AjaxResponse) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, contentType)
+	req.Header.Set(fiber.HeaderAccept, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &httpxcommons.AjaxResponse{}
+	if err := json.Unmarshal(data, result); err != nil {
+		t.Fatalf("响应不是 AjaxResponse: %s", data)
+	}
+	return resp.StatusCode, result
+}
+
+type greetRequest struct {
+	ID   int    `param:"id" json:"-"`
+	Name string `json:"name" binding:"required"`
+}
+
+type greetResponse struct {
+	Greeting string `json:"greeting"`
+}
+
+func TestHandle(t *testing.T) {
+	app := fiber.New()
+	app.Post("/users/:id", Handle(func(ctx context.Context, req *greetRequest) (*greetResponse, error) {
+		switch req.Name {
+		case "conflict":
+			return nil, fiber.ErrConflict
+		case "internal":
+			return nil, es.New("db: password=secret")
+		}
+		return &greetResponse{Greeting: "hello " + req.Name}, nil
+	}))
+	status, resp := callJSON(t, app, fiber.MethodPost, "/users/1", fiber.MIMEApplicationJSON, `{"name":"a"}`)
+	if status != fiber.StatusOK || !resp.Success || resp.Payload.(map[string]interface{})["greeting"] != "hello a" {
+		t.Fatalf("status=%d resp=%+v", status, resp)
+	}
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		message     string
+	}{
+		{"请求体格式错误", fiber.MIMEApplicationJSON, `{"name":`, fiber.StatusBadRequest, "请求内容解析失败"},
+		{"请求体存在多余内容", fiber.MIMEApplicationJSON, `{"name":"a"} {}`, fiber.StatusBadRequest, "请求体存在多余内容"},
+		{"参数校验失败", fiber.MIMEApplicationJSON, `{}`, fiber.StatusBadRequest, "参数校验失败"},
+		{"绑定对象类型不支持", MIMEPROTOBUF, "\x0a\x01a", fiber.StatusInternalServerError, "系统内部错误"},
+		{"业务错误", fiber.MIMEApplicationJSON, `{"name":"conflict"}`, fiber.StatusConflict, fiber.ErrConflict.Message},
+		{"内部错误", fiber.MIMEApplicationJSON, `{"name":"internal"}`, fiber.StatusInternalServerError, "系统内部错误"},
+	}
+	for _, tc := range cases {
+		status, resp := callJSON(t, app, fiber.MethodPost, "/users/1", tc.contentType, tc.body)
+		if status != tc.status || resp.Code != int64(tc.status) || resp.Success || !strings.HasPrefix(resp.Message, tc.message) {
+			t.Fatalf("%s: status=%d resp=%+v", tc.name, status, resp)
+		}
+	}
+	if _, resp := callJSON(t, app, fiber.MethodPost, "/users/1", fiber.MIMEApplicationJSON, `{}`); len(resp.Errors) != 1 || resp.Errors[0].Field != "name" {
+		t.Fatalf("参数校验失败时应返回字段错误, got %+v", resp.Errors)
+	}
+	if _, resp := callJSON(t, app, fiber.MethodPost, "/users/x", fiber.MIMEApplicationJSON, `{"name":"a"}`); len(resp.Errors) != 1 || resp.Errors[0].Field != "id" {
+		t.Fatalf("路由参数类型错误时应返回字段错误, got %+v", resp)
+	}
+}
+
+func TestDefaultErrorHandler(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: DefaultErrorHandler})
+	app.Post("/bind", func(c *fiber.Ctx) error {
+		req := &greetRequest{}
+		if err := Bind(c, req); err != nil {
+			return err
+		}
+		return c.SendString(req.Name)
+	})
+	app.Get("/forbidden", func(c *fiber.Ctx) error {
+		return fiber.ErrForbidden
+	})
+	app.Get("/timeout", func(c *fiber.Ctx) error {
+		return context.DeadlineExceeded
+	})
+	app.Get("/internal", func(c *fiber.Ctx) error {
+		return es.New("db: password=secret")
+	})
+	cases := []struct {
+		method, target, body string
+		status               int
+		message              string
+	}{
+		{fiber.MethodPost, "/bind", `{"name":`, fiber.StatusBadRequest, "请求内容解析失败"},
+		{fiber.MethodPost, "/bind", `{}`, fiber.StatusBadRequest, "参数校验失败"},
+		{fiber.MethodGet, "/forbidden", "", fiber.StatusForbidden, fiber.ErrForbidden.Message},
+		{fiber.MethodGet, "/timeout", "", fiber.StatusRequestTimeout, "请求超时"},
+		{fiber.MethodGet, "/internal", "", fiber.StatusInternalServerError, "系统内部错误"},
+		{fiber.MethodGet, "/missing", "", fiber.StatusNotFound, "Cannot GET /missing"},
+	}
+	for _, tc := range cases {
+		status, resp := callJSON(t, app, tc.method, tc.target, fiber.MIMEApplicationJSON, tc.body)
+		if status != tc.status || resp.Code != int64(tc.status) || !strings.HasPrefix(resp.Message, tc.message) {
+			t.Fatalf("%s %s: status=%d resp=%+v", tc.method, tc.target, status, resp)
+		}
+	}
+}
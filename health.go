@@ -0,0 +1,215 @@
+package httpx
+
+import (
+	"context"
+	"fmt"
+	"github.com/coffeehc/base/errors"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"github.com/gofiber/fiber/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 健康状态
+const (
+	HealthStatusUp       = "up"
+	HealthStatusDown     = "down"
+	HealthStatusDegraded = "degraded"
+)
+
+// HealthCheck 健康检查项
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+	// Timeout 单次检查的超时时间,默认3秒
+	Timeout time.Duration
+	// Critical 为 true 时检查失败会导致 /healthz、/readyz 返回失败,否则只标记为 degraded
+	Critical bool
+	// Liveness 为 true 时同时作为存活检查(/livez),只应包含进程自身的检查,不要包含外部依赖
+	Liveness bool
+}
+
+// HealthResult 单个检查项的结果
+type HealthResult struct {
+	Status     string    `json:"status"`
+	Critical   bool      `json:"critical"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// HealthReport 健康检查汇总结果
+type HealthReport struct {
+	Status string                   `json:"status"`
+	Checks map[string]*HealthResult `json:"checks,omitempty"`
+}
+
+type healthEntry struct {
+	check  HealthCheck
+	mutex  sync.Mutex
+	result *HealthResult
+}
+
+// HealthRegistry 健康检查注册表,检查结果在 cacheInterval 内复用,避免频繁访问依赖
+type HealthRegistry struct {
+	mutex         sync.RWMutex
+	entries       []*healthEntry
+	cacheInterval time.Duration
+	started       atomic.Bool
+	shuttingDown  atomic.Bool
+}
+
+func NewHealthRegistry(cacheInterval time.Duration) *HealthRegistry {
+	return &HealthRegistry{cacheInterval: cacheInterval}
+}
+
+// Register 注册检查项,名称不能重复
+func (impl *HealthRegistry) Register(check HealthCheck) error {
+	if check.Name == "" || check.Check == nil {
+		return errors.SystemError("健康检查的名称和检查函数不能为空")
+	}
+	if check.Timeout <= 0 {
+		check.Timeout = 3 * time.Second
+	}
+	impl.mutex.Lock()
+	defer impl.mutex.Unlock()
+	for _, entry := range impl.entries {
+		if entry.check.Name == check.Name {
+			return errors.SystemError(fmt.Sprintf("健康检查%s已经注册", check.Name))
+		}
+	}
+	impl.entries = append(impl.entries, &healthEntry{check: check})
+	return nil
+}
+
+// SetStarted 标记服务已经启动完成,之前 /startupz 和 /readyz 始终返回失败。
+// Service 默认在开始监听时自动调用,Config.ManualStartup 为 true 时需要应用在预热完成后调用
+func (impl *HealthRegistry) SetStarted() {
+	impl.started.Store(true)
+}
+
+func (impl *HealthRegistry) IsStarted() bool {
+	return impl.started.Load()
+}
+
+// SetShuttingDown 标记服务正在关闭,之后 /readyz 始终返回失败,Service.Shutdown 开始时自动调用
+func (impl *HealthRegistry) SetShuttingDown() {
+	impl.shuttingDown.Store(true)
+}
+
+func (impl *HealthRegistry) IsShuttingDown() bool {
+	return impl.shuttingDown.Load()
+}
+
+// Check 并发执行检查项并汇总结果,livenessOnly 为 true 时只执行存活检查
+func (impl *HealthRegistry) Check(ctx context.Context, livenessOnly bool) *HealthReport {
+	impl.mutex.RLock()
+	entries := make([]*healthEntry, 0, len(impl.entries))
+	for _, entry := range impl.entries {
+		if !livenessOnly || entry.check.Liveness {
+			entries = append(entries, entry)
+		}
+	}
+	impl.mutex.RUnlock()
+	results := make([]*HealthResult, len(entries))
+	var wg sync.WaitGroup
+	for i, entry := range entries {
+		wg.Add(1)
+		go func(i int, entry *healthEntry) {
+			defer wg.Done()
+			results[i] = impl.run(ctx, entry)
+		}(i, entry)
+	}
+	wg.Wait()
+	report := &HealthReport{Status: HealthStatusUp, Checks: make(map[string]*HealthResult, len(entries))}
+	for i, entry := range entries {
+		result := results[i]
+		report.Checks[entry.check.Name] = result
+		if result.Status == HealthStatusUp {
+			continue
+		}
+		if result.Critical {
+			report.Status = HealthStatusDown
+		} else if report.Status == HealthStatusUp {
+			report.Status = HealthStatusDegraded
+		}
+	}
+	return report
+}
+
+// run 执行单个检查项,缓存未过期时直接返回上次的结果
+func (impl *HealthRegistry) run(ctx context.Context, entry *healthEntry) *HealthResult {
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+	if entry.result != nil && time.Since(entry.result.CheckedAt) < impl.cacheInterval {
+		return entry.result
+	}
+	start := time.Now()
+	checkCtx, cancel := context.WithTimeout(ctx, entry.check.Timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- errors.ConverUnknowError(r)
+			}
+		}()
+		done <- entry.check.Check(checkCtx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-checkCtx.Done():
+		err = checkCtx.Err()
+	}
+	result := &HealthResult{
+		Status:     HealthStatusUp,
+		Critical:   entry.check.Critical,
+		DurationMs: time.Since(start).Milliseconds(),
+		CheckedAt:  start,
+	}
+	if err != nil {
+		result.Status = HealthStatusDown
+		result.Error = err.Error()
+	}
+	entry.result = result
+	return result
+}
+
+// RegisterHandlers 在 router 上挂载 /healthz、/readyz、/livez、/startupz,
+// /startupz 在 SetStarted 之前返回失败,之后只执行存活检查
+func (impl *HealthRegistry) RegisterHandlers(router fiber.Router) {
+	router.Get("/healthz", func(c *fiber.Ctx) error {
+		return sendHealthReport(c, impl.Check(c.UserContext(), false))
+	})
+	router.Get("/readyz", func(c *fiber.Ctx) error {
+		if !impl.IsStarted() || impl.IsShuttingDown() {
+			return sendHealthReport(c, &HealthReport{Status: HealthStatusDown})
+		}
+		return sendHealthReport(c, impl.Check(c.UserContext(), false))
+	})
+	router.Get("/startupz", func(c *fiber.Ctx) error {
+		if !impl.IsStarted() {
+			return sendHealthReport(c, &HealthReport{Status: HealthStatusDown})
+		}
+		return sendHealthReport(c, impl.Check(c.UserContext(), true))
+	})
+	router.Get("/livez", func(c *fiber.Ctx) error {
+		return sendHealthReport(c, impl.Check(c.UserContext(), true))
+	})
+}
+
+func sendHealthReport(c *fiber.Ctx, report *HealthReport) error {
+	response := &httpxcommons.AjaxResponse{
+		Success:   report.Status != HealthStatusDown,
+		Message:   report.Status,
+		Payload:   report,
+		RequestID: httpxcommons.GetRequestID(c),
+	}
+	if !response.Success {
+		response.Code = fiber.StatusServiceUnavailable
+		c.Status(fiber.StatusServiceUnavailable)
+	}
+	return c.JSON(response)
+}
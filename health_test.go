@@ -0,0 +1,184 @@
+package httpx
+
+import (
+	"context"
+	es "errors"
+	"github.com/gofiber/fiber/v2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthRegistryCheck(t *testing.T) {
+	registry := NewHealthRegistry(time.Minute)
+	var calls atomic.Int64
+	checks := []HealthCheck{
+		{Name: "self", Liveness: true, Critical: true, Check: func(ctx context.Context) error { return nil }},
+		{Name: "cache", Check: func(ctx context.Context) error {
+			calls.Add(1)
+			return es.New("cache down")
+		}},
+		{Name: "slow", Timeout: 10 * time.Millisecond, Check: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}},
+		{Name: "panic", Check: func(ctx context.Context) error { panic("boom") }},
+	}
+	for _, check := range checks {
+		if err := registry.Register(check); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := registry.Register(checks[0]); err == nil {
+		t.Fatal("重复注册应返回错误")
+	}
+	report := registry.Check(context.Background(), false)
+	if report.Status != HealthStatusDegraded {
+		t.Fatalf("非关键检查失败时应为 degraded, got %s", report.Status)
+	}
+	for _, name := range []string{"cache", "slow", "panic"} {
+		if report.Checks[name].Status != HealthStatusDown {
+			t.Fatalf("%s 应为 down, got %+v", name, report.Checks[name])
+		}
+	}
+	registry.Check(context.Background(), false)
+	if calls.Load() != 1 {
+		t.Fatalf("缓存时间内不应重复检查, calls=%d", calls.Load())
+	}
+	if report := registry.Check(context.Background(), true); len(report.Checks) != 1 || report.Status != HealthStatusUp {
+		t.Fatalf("存活检查只应包含 Liveness 检查项, got %+v", report)
+	}
+	registry.Register(HealthCheck{Name: "db", Critical: true, Check: func(ctx context.Context) error { return es.New("db down") }})
+	if report := registry.Check(context.Background(), false); report.Status != HealthStatusDown {
+		t.Fatalf("关键检查失败时应为 down, got %s", report.Status)
+	}
+}
+
+// getStatus 不复用连接,避免客户端预先建立但没有发送请求的连接拖慢服务关闭
+func getStatus(t *testing.T, url string) int {
+	t.Helper()
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// 关闭时 /readyz 先返回失败,监听在 ShutdownDelayMs 之后才关闭
+func TestReadinessFailsBeforeListenerCloses(t *testing.T) {
+	config := GetDefaultConfig("127.0.0.1:0", "test")
+	config.DisableStartupMessage = true
+	config.EnableHealthCheck = true
+	config.ShutdownDelayMs = 300
+	service, err := NewServiceWithError(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorSign := service.Start(nil)
+	base := "http://" + service.GetServerAddress()
+	waitListening(t, service.GetServerAddress())
+	if status := getStatus(t, base+"/readyz"); status != fiber.StatusOK {
+		t.Fatalf("status=%d", status)
+	}
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- service.Shutdown()
+	}()
+	deadline := time.Now().Add(time.Second)
+	for !service.GetHealthRegistry().IsShuttingDown() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if status := getStatus(t, base+"/readyz"); status != fiber.StatusServiceUnavailable {
+		t.Fatalf("关闭开始后 /readyz 应返回503, status=%d", status)
+	}
+	if status := getStatus(t, base+"/livez"); status != fiber.StatusOK {
+		t.Fatalf("等待期间 /livez 应正常, status=%d", status)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+	<-errorSign
+}
+
+func TestShutdownDelayDefault(t *testing.T) {
+	if delay := (&Config{EnableHealthCheck: true}).getShutdownDelay(); delay != 5*time.Second {
+		t.Fatalf("开启健康检查时默认应等待5秒, got %s", delay)
+	}
+	if delay := (&Config{ShutdownDelayMs: 3000}).getShutdownDelay(); delay != 0 {
+		t.Fatalf("没有开启健康检查时不等待, got %s", delay)
+	}
+	if delay := (&Config{EnableHealthCheck: true, ShutdownDelayMs: -1}).getShutdownDelay(); delay != 0 {
+		t.Fatalf("小于0时不等待, got %s", delay)
+	}
+}
+
+// 默认不挂载健康检查接口,应用可以使用相同的路径
+func TestHealthCheckOptIn(t *testing.T) {
+	service := newTestService(t)
+	service.GetEngine().Get("/healthz", func(c *fiber.Ctx) error {
+		return c.SendString("app")
+	})
+	resp, err := service.GetEngine().Test(httptest.NewRequest(fiber.MethodGet, "/healthz", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != "app" {
+		t.Fatalf("got %q", body)
+	}
+	if resp, _ := service.GetEngine().Test(httptest.NewRequest(fiber.MethodGet, "/readyz", nil)); resp.StatusCode != fiber.StatusNotFound {
+		t.Fatalf("没有开启时不应挂载 /readyz, status=%d", resp.StatusCode)
+	}
+}
+
+// ManualStartup 时 /startupz 和 /readyz 在 SetStarted 之前返回失败
+func TestStartupProbe(t *testing.T) {
+	config := GetDefaultConfig("127.0.0.1:0", "test")
+	config.DisableStartupMessage = true
+	config.EnableHealthCheck = true
+	config.ManualStartup = true
+	config.ShutdownDelayMs = -1
+	service, err := NewServiceWithError(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := runAsync(ctx, service)
+	defer func() {
+		cancel()
+		waitRun(t, done)
+	}()
+	waitListening(t, service.GetServerAddress())
+	base := "http://" + service.GetServerAddress()
+	for _, path := range []string{"/startupz", "/readyz"} {
+		if status := getStatus(t, base+path); status != fiber.StatusServiceUnavailable {
+			t.Fatalf("启动完成前 %s 应返回503, status=%d", path, status)
+		}
+	}
+	if status := getStatus(t, base+"/livez"); status != fiber.StatusOK {
+		t.Fatalf("启动完成前 /livez 应正常, status=%d", status)
+	}
+	service.GetHealthRegistry().SetStarted()
+	for _, path := range []string{"/startupz", "/readyz"} {
+		if status := getStatus(t, base+path); status != fiber.StatusOK {
+			t.Fatalf("启动完成后 %s 应正常, status=%d", path, status)
+		}
+	}
+}
+
+// 默认在开始监听时自动标记为已启动
+func TestStartupAutomatic(t *testing.T) {
+	service := newTestService(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := runAsync(ctx, service)
+	waitListening(t, service.GetServerAddress())
+	if !service.GetHealthRegistry().IsStarted() {
+		t.Fatal("开始监听后应标记为已启动")
+	}
+	cancel()
+	assertCleanExit(t, waitRun(t, done), ExitReasonContextDone)
+}
@@ -0,0 +1,178 @@
+package httpxcommons
+
+import (
+	"context"
+	es "errors"
+	"github.com/coffeehc/base/errors"
+	"github.com/gofiber/fiber/v2"
+	"sync"
+)
+
+// ErrorMapping 错误对应的HTTP状态码、业务码和返回给客户端的信息
+type ErrorMapping struct {
+	StatusCode int
+	Code       int64
+	// Message 返回给客户端的信息,不应包含内部细节
+	Message string
+}
+
+// ErrorMapper 将错误转换为 ErrorMapping,不处理该错误时返回 false
+type ErrorMapper func(err error) (*ErrorMapping, bool)
+
+const internalErrorMessage = "系统内部错误"
+
+// StatusClientClosedRequest 客户端在响应前断开连接(请求的 context 被取消)时使用的状态码,与 nginx 一致
+const StatusClientClosedRequest = 499
+
+// registeredMapper 已注册的转换规则,id 用于注销
+type registeredMapper struct {
+	id     uint64
+	mapper ErrorMapper
+}
+
+var (
+	errorMapperMutex sync.RWMutex
+	errorMapperID    uint64
+	// errorMappers 按注册的逆序匹配,后注册的优先,默认规则不在其中,在所有注册的规则之后匹配
+	errorMappers []registeredMapper
+	// defaultErrorMappers 默认规则,按顺序匹配
+	defaultErrorMappers = []ErrorMapper{
+		mapValidationErrors,
+		mapFiberError,
+		mapContextError,
+		mapBaseError,
+	}
+)
+
+// RegisterErrorMapper 注册错误转换规则,后注册的规则优先于先注册的规则和默认规则,
+// 返回的函数用于注销该规则,测试中可以配合 t.Cleanup 使用
+func RegisterErrorMapper(mapper ErrorMapper) (unregister func()) {
+	errorMapperMutex.Lock()
+	defer errorMapperMutex.Unlock()
+	errorMapperID++
+	id := errorMapperID
+	errorMappers = append(errorMappers, registeredMapper{id: id, mapper: mapper})
+	return func() {
+		errorMapperMutex.Lock()
+		defer errorMapperMutex.Unlock()
+		for i, registered := range errorMappers {
+			if registered.id == id {
+				errorMappers = append(errorMappers[:i:i], errorMappers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// ResetErrorMappers 注销所有注册的转换规则,只保留默认规则
+func ResetErrorMappers() {
+	errorMapperMutex.Lock()
+	defer errorMapperMutex.Unlock()
+	errorMappers = nil
+}
+
+// RegisterErrorMapping 为 match 返回 true 的错误注册固定的转换结果,可用于 errors.Is 判断的哨兵错误,
+// 返回的函数用于注销该规则
+func RegisterErrorMapping(match func(err error) bool, mapping ErrorMapping) (unregister func()) {
+	return RegisterErrorMapper(func(err error) (*ErrorMapping, bool) {
+		if !match(err) {
+			return nil, false
+		}
+		return &mapping, true
+	})
+}
+
+// RegisterErrorType 为错误链中包含 T 类型(通过 errors.As 判断)的错误注册转换结果,
+// mapping.Message 为空时使用错误本身的信息,返回的函数用于注销该规则
+func RegisterErrorType[T error](mapping ErrorMapping) (unregister func()) {
+	return RegisterErrorMapper(func(err error) (*ErrorMapping, bool) {
+		var target T
+		if !es.As(err, &target) {
+			return nil, false
+		}
+		m := mapping
+		if m.Message == "" {
+			m.Message = target.Error()
+		}
+		return &m, true
+	})
+}
+
+// MapError 返回错误对应的 ErrorMapping,没有规则匹配时返回500和"系统内部错误"
+func MapError(err error) *ErrorMapping {
+	if mapping, ok := mapError(err); ok {
+		return mapping
+	}
+	return &ErrorMapping{StatusCode: fiber.StatusInternalServerError, Code: fiber.StatusInternalServerError, Message: internalErrorMessage}
+}
+
+func mapError(err error) (*ErrorMapping, bool) {
+	errorMapperMutex.RLock()
+	defer errorMapperMutex.RUnlock()
+	for i := len(errorMappers) - 1; i >= 0; i-- {
+		if mapping, ok := errorMappers[i].mapper(err); ok {
+			return mapping, true
+		}
+	}
+	for _, mapper := range defaultErrorMappers {
+		if mapping, ok := mapper(err); ok {
+			return mapping, true
+		}
+	}
+	return nil, false
+}
+
+func mapValidationErrors(err error) (*ErrorMapping, bool) {
+	var fieldErrors ValidationErrors
+	if !es.As(err, &fieldErrors) {
+		return nil, false
+	}
+	return &ErrorMapping{StatusCode: fiber.StatusBadRequest, Code: fiber.StatusBadRequest, Message: "参数校验失败"}, true
+}
+
+func mapFiberError(err error) (*ErrorMapping, bool) {
+	var fiberErr *fiber.Error
+	if !es.As(err, &fiberErr) {
+		return nil, false
+	}
+	return &ErrorMapping{StatusCode: fiberErr.Code, Code: int64(fiberErr.Code), Message: fiberErr.Message}, true
+}
+
+func mapContextError(err error) (*ErrorMapping, bool) {
+	switch {
+	case es.Is(err, context.DeadlineExceeded):
+		return &ErrorMapping{StatusCode: fiber.StatusRequestTimeout, Code: fiber.StatusRequestTimeout, Message: "请求超时"}, true
+	case es.Is(err, context.Canceled):
+		return &ErrorMapping{StatusCode: StatusClientClosedRequest, Code: StatusClientClosedRequest, Message: "请求已取消"}, true
+	default:
+		return nil, false
+	}
+}
+
+// codeError 带业务码的错误
+type codeError interface {
+	error
+	GetCode() int64
+}
+
+// mapBaseError 处理 coffeehc/base 的错误,MessageError 的信息可以直接返回给客户端,系统错误和数据库错误只返回通用信息
+func mapBaseError(err error) (*ErrorMapping, bool) {
+	var code int64
+	var codeErr codeError
+	if es.As(err, &codeErr) {
+		code = codeErr.GetCode()
+	}
+	var mapping *ErrorMapping
+	switch {
+	case errors.IsMessageError(err):
+		mapping = &ErrorMapping{StatusCode: fiber.StatusBadRequest, Code: code, Message: err.Error()}
+	case errors.IsSystemError(err) || errors.IsDBError(err):
+		mapping = &ErrorMapping{StatusCode: fiber.StatusInternalServerError, Code: code, Message: internalErrorMessage}
+	default:
+		return nil, false
+	}
+	if mapping.Code == 0 {
+		mapping.Code = int64(mapping.StatusCode)
+	}
+	return mapping, true
+}
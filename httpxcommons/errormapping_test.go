@@ -0,0 +1,109 @@
+package httpxcommons
+
+import (
+	"context"
+	"encoding/json"
+	es "errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"net/http/httptest"
+	"testing"
+)
+
+type quotaError struct {
+	resource string
+}
+
+func (e *quotaError) Error() string {
+	return e.resource + " 配额不足"
+}
+
+func TestMapError(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+	}{
+		{ValidationErrors{{Field: "name"}}, fiber.StatusBadRequest},
+		{fmt.Errorf("wrap: %w", context.DeadlineExceeded), fiber.StatusRequestTimeout},
+		{fmt.Errorf("wrap: %w", context.Canceled), StatusClientClosedRequest},
+		{fiber.ErrNotFound, fiber.StatusNotFound},
+		{es.New("db: connection refused"), fiber.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		if mapping := MapError(tc.err); mapping.StatusCode != tc.status {
+			t.Fatalf("%v: got %+v", tc.err, mapping)
+		}
+	}
+	if mapping := MapError(es.New("db: connection refused")); mapping.Message != internalErrorMessage {
+		t.Fatalf("未匹配的错误不应返回内部信息, got %q", mapping.Message)
+	}
+}
+
+func TestRegisterErrorType(t *testing.T) {
+	t.Cleanup(RegisterErrorType[*quotaError](ErrorMapping{StatusCode: fiber.StatusTooManyRequests, Code: 42901}))
+	mapping := MapError(fmt.Errorf("调用失败: %w", &quotaError{resource: "cpu"}))
+	if mapping.StatusCode != fiber.StatusTooManyRequests || mapping.Code != 42901 || mapping.Message != "cpu 配额不足" {
+		t.Fatalf("got %+v", mapping)
+	}
+}
+
+func TestUnregisterErrorMapper(t *testing.T) {
+	t.Cleanup(ResetErrorMappers)
+	err := &quotaError{resource: "cpu"}
+	first := RegisterErrorType[*quotaError](ErrorMapping{StatusCode: fiber.StatusTooManyRequests})
+	second := RegisterErrorMapping(func(err error) bool { return es.Is(err, fiber.ErrNotFound) }, ErrorMapping{StatusCode: fiber.StatusGone})
+	if mapping := MapError(fiber.ErrNotFound); mapping.StatusCode != fiber.StatusGone {
+		t.Fatalf("注册的规则应优先于默认规则, got %+v", mapping)
+	}
+	second()
+	second()
+	if mapping := MapError(fiber.ErrNotFound); mapping.StatusCode != fiber.StatusNotFound {
+		t.Fatalf("注销后应使用默认规则, got %+v", mapping)
+	}
+	if mapping := MapError(err); mapping.StatusCode != fiber.StatusTooManyRequests {
+		t.Fatalf("注销其它规则不应影响该规则, got %+v", mapping)
+	}
+	first()
+	if mapping := MapError(err); mapping.StatusCode != fiber.StatusInternalServerError {
+		t.Fatalf("got %+v", mapping)
+	}
+	RegisterErrorType[*quotaError](ErrorMapping{StatusCode: fiber.StatusTooManyRequests})
+	ResetErrorMappers()
+	if mapping := MapError(err); mapping.StatusCode != fiber.StatusInternalServerError {
+		t.Fatalf("ResetErrorMappers 后只保留默认规则, got %+v", mapping)
+	}
+	if mapping := MapError(fiber.ErrNotFound); mapping.StatusCode != fiber.StatusNotFound {
+		t.Fatalf("ResetErrorMappers 不应移除默认规则, got %+v", mapping)
+	}
+}
+
+func TestSendErrors(t *testing.T) {
+	t.Cleanup(RegisterErrorType[*quotaError](ErrorMapping{StatusCode: fiber.StatusTooManyRequests}))
+	cases := []struct {
+		err     error
+		message string
+	}{
+		{es.New("db: password=secret"), internalErrorMessage},
+		{&quotaError{resource: "cpu"}, "cpu 配额不足"},
+		{ValidationErrors{{Field: "name"}}, "参数校验失败"},
+	}
+	for _, tc := range cases {
+		app := fiber.New()
+		app.Get("/", func(c *fiber.Ctx) error {
+			return SendErrors(c, tc.err, 10001, fiber.StatusConflict)
+		})
+		req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+		req.Header.Set(fiber.HeaderAccept, fiber.MIMEApplicationJSON)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := &AjaxResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusConflict || result.Code != 10001 || result.Message != tc.message {
+			t.Fatalf("%v: status=%d resp=%+v", tc.err, resp.StatusCode, result)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package httpxcommons
 
+import "strings"
+
 type BaseResponse interface {
 	IsSuccess() bool
 	GetMessage() string
@@ -35,9 +37,22 @@ type AjaxResponse struct {
 	RequestID string      `json:"request_id"`
 	Code      int64       `json:"code"`
 	Redirect  string      `json:"redirect,omitempty"`
+	// Errors 参数校验失败时的字段错误列表
+	Errors []*FieldError `json:"errors,omitempty"`
 }
 
 type ListData struct {
 	List  interface{} `json:"list"`
 	Total int64       `json:"total"`
 }
+
+// ValidationErrors 参数校验失败的字段错误列表
+type ValidationErrors []*FieldError
+
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, 0, len(errs))
+	for _, e := range errs {
+		messages = append(messages, e.GetField()+": "+e.GetMessage())
+	}
+	return strings.Join(messages, "; ")
+}
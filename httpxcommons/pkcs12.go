@@ -0,0 +1,78 @@
+package httpxcommons
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	es "errors"
+	"fmt"
+	"github.com/coffeehc/base/errors"
+	"github.com/youmark/pkcs8"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// LoadPKCS12 从 PKCS#12(.p12/.pfx)文件内容中加载证书链和私钥,
+// 兼容 OpenSSL 3 默认的 AES 加密以及 OpenSSL 1.1、-legacy、Windows/Java 导出的 RC2/3DES 加密
+func LoadPKCS12(raw []byte, password string) (tls.Certificate, error) {
+	var cert tls.Certificate
+	key, leaf, caCerts, err := pkcs12.DecodeChain(raw, password)
+	if err != nil {
+		if es.Is(err, pkcs12.ErrIncorrectPassword) {
+			return cert, errors.SystemError("PKCS12密码错误")
+		}
+		return cert, errors.SystemError(fmt.Sprintf("解析PKCS12失败: %s", err))
+	}
+	if !isSupportedPrivateKey(key) {
+		return cert, errors.SystemError("不支持的私钥类型")
+	}
+	cert.PrivateKey = key
+	cert.Certificate = append(cert.Certificate, leaf.Raw)
+	for _, ca := range caCerts {
+		cert.Certificate = append(cert.Certificate, ca.Raw)
+	}
+	// PKCS#12 中证书的顺序不固定,按私钥找到叶子证书放到证书链的第一个
+	if err := moveLeafFirst(&cert); err != nil {
+		return cert, err
+	}
+	return cert, checkKeyPair(&cert)
+}
+
+// moveLeafFirst 按私钥找到叶子证书并放到证书链的第一个
+func moveLeafFirst(cert *tls.Certificate) error {
+	for i, der := range cert.Certificate {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return errors.SystemError("解析公钥证书失败")
+		}
+		if publicKeyMatches(cert.PrivateKey, c.PublicKey) {
+			cert.Certificate[0], cert.Certificate[i] = cert.Certificate[i], cert.Certificate[0]
+			return nil
+		}
+	}
+	return errors.SystemError("私钥与证书不匹配")
+}
+
+// decryptPKCS8 解密 PKCS8 ENCRYPTED PRIVATE KEY,支持 PBES2(PBKDF2/scrypt + AES/3DES)
+func decryptPKCS8(der []byte, password string) (crypto.PrivateKey, error) {
+	key, err := pkcs8.ParsePKCS8PrivateKey(der, []byte(password))
+	if err != nil {
+		return nil, errors.SystemError("解密私钥失败,密码可能错误")
+	}
+	if !isSupportedPrivateKey(key) {
+		return nil, errors.SystemError("加载PKCS8私钥失败")
+	}
+	return key, nil
+}
+
+// isSupportedPrivateKey 判断是否为 tls 支持的私钥类型
+func isSupportedPrivateKey(key interface{}) bool {
+	switch key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,112 @@
+package httpxcommons
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func checkLeaf(t *testing.T, cert tls.Certificate, chainLen int) {
+	t.Helper()
+	if cert.Leaf == nil || cert.Leaf.Subject.CommonName != "localhost" {
+		t.Fatalf("叶子证书应排在第一个, got %v", cert.Leaf)
+	}
+	if len(cert.Certificate) != chainLen {
+		t.Fatalf("证书链长度应为%d, got %d", chainLen, len(cert.Certificate))
+	}
+}
+
+func TestLoadPKCS12(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		password string
+		chainLen int
+		ed25519  bool
+	}{
+		// OpenSSL 3 默认: PBES2 + AES-256-CBC,MAC 为 SHA-256
+		{name: "modern", file: "modern.p12", password: "secret", chainLen: 2},
+		// OpenSSL 1.1 / -legacy: 证书使用 RC2-40,私钥使用 3DES
+		{name: "legacy", file: "legacy.p12", password: "secret", chainLen: 2},
+		{name: "no password", file: "nopassword.p12", password: "", chainLen: 1},
+		{name: "ed25519", file: "ed25519.p12", password: "secret", chainLen: 1, ed25519: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := LoadPKCS12(readTestdata(t, tt.file), tt.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkLeaf(t, cert, tt.chainLen)
+			if _, ok := cert.PrivateKey.(ed25519.PrivateKey); ok != tt.ed25519 {
+				t.Fatalf("unexpected private key type %T", cert.PrivateKey)
+			}
+		})
+	}
+}
+
+func TestLoadPKCS12WrongPassword(t *testing.T) {
+	for _, file := range []string{"modern.p12", "legacy.p12"} {
+		if _, err := LoadPKCS12(readTestdata(t, file), "wrong"); err == nil {
+			t.Fatalf("%s 密码错误时应返回错误", file)
+		}
+	}
+}
+
+func TestLoadPKCS12Invalid(t *testing.T) {
+	if _, err := LoadPKCS12([]byte("not a pkcs12 file"), ""); err == nil {
+		t.Fatal("非 PKCS12 数据应返回错误")
+	}
+}
+
+func TestLoadCertificateWithPasswordEncryptedPKCS8(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{name: "rsa aes-256", file: "rsa_encrypted.pem"},
+		{name: "ed25519 aes-128", file: "ed25519_encrypted.pem"},
+		{name: "ed25519 scrypt", file: "ed25519_scrypt.pem"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := readTestdata(t, tt.file)
+			cert, err := LoadCertificateWithPassword(raw, "secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkLeaf(t, cert, 1)
+			if _, err := LoadCertificateWithPassword(raw, "wrong"); err == nil {
+				t.Fatal("密码错误时应返回错误")
+			}
+			if _, err := LoadCertificateWithPassword(raw, ""); err == nil {
+				t.Fatal("没有密码时应返回错误")
+			}
+		})
+	}
+	cert, err := LoadCertificateWithPassword(readTestdata(t, "rsa_encrypted.pem"), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cert.PrivateKey.(*rsa.PrivateKey); !ok {
+		t.Fatalf("unexpected private key type %T", cert.PrivateKey)
+	}
+}
+
+func TestLoadCertificateKeyMismatch(t *testing.T) {
+	if _, err := LoadCertificate(readTestdata(t, "mismatch.pem")); err == nil {
+		t.Fatal("私钥与证书不匹配时应返回错误")
+	}
+}
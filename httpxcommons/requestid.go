@@ -0,0 +1,26 @@
+package httpxcommons
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+)
+
+type requestIDKey struct{}
+
+// SetRequestID 将请求ID保存到 Locals 和 UserContext 中,Send* 系列函数会自动填充到响应里
+func SetRequestID(c *fiber.Ctx, requestID string) {
+	c.Locals(requestIDKey{}, requestID)
+	c.SetUserContext(context.WithValue(c.UserContext(), requestIDKey{}, requestID))
+}
+
+// GetRequestID 返回当前请求的ID,没有设置时返回空字符串
+func GetRequestID(c *fiber.Ctx) string {
+	requestID, _ := c.Locals(requestIDKey{}).(string)
+	return requestID
+}
+
+// RequestIDFromContext 从 UserContext 派生的 context 中获取请求ID
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
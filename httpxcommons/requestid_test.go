@@ -0,0 +1,102 @@
+package httpxcommons
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"io"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestIDContext(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		if GetRequestID(c) != "" || RequestIDFromContext(c.UserContext()) != "" {
+			t.Error("没有设置时应返回空字符串")
+		}
+		SetRequestID(c, "req-1")
+		ctx, cancel := context.WithCancel(c.UserContext())
+		defer cancel()
+		if GetRequestID(c) != "req-1" || RequestIDFromContext(ctx) != "req-1" {
+			t.Errorf("got %q %q", GetRequestID(c), RequestIDFromContext(ctx))
+		}
+		return nil
+	})
+	if _, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// request_id 使用字段号7,3 曾是 int64 类型的 request_id,已保留
+func TestPBResponseRequestIDField(t *testing.T) {
+	fields := (&PBResponse{}).ProtoReflect().Descriptor()
+	field := fields.Fields().ByName("request_id")
+	if field == nil || field.Number() != 7 || field.Kind() != protoreflect.StringKind {
+		t.Fatalf("request_id 字段定义错误: %v", field)
+	}
+	if fields.Fields().ByNumber(3) != nil || !fields.ReservedRanges().Has(3) {
+		t.Fatal("字段号3应保留")
+	}
+	data, err := proto.Marshal(&PBResponse{RequestId: "req-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	number, typ, n := protowire.ConsumeTag(data)
+	value, _ := protowire.ConsumeBytes(data[n:])
+	if number != 7 || typ != protowire.BytesType || string(value) != "req-1" {
+		t.Fatalf("编码结果错误: %x", data)
+	}
+	// 旧版本写入字段3的数据不应被解析为 request_id
+	legacy := protowire.AppendVarint(protowire.AppendTag(nil, 3, protowire.VarintType), 42)
+	resp := &PBResponse{}
+	if err := proto.Unmarshal(legacy, resp); err != nil || resp.RequestId != "" {
+		t.Fatalf("resp=%v err=%v", resp, err)
+	}
+}
+
+func TestSendFillsRequestID(t *testing.T) {
+	app := fiber.New()
+	app.Get("/success", func(c *fiber.Ctx) error {
+		SetRequestID(c, "req-1")
+		return SendSuccess(c, "ok", 0)
+	})
+	app.Get("/error", func(c *fiber.Ctx) error {
+		SetRequestID(c, "req-1")
+		return SendError(c, "失败", 10001, fiber.StatusConflict)
+	})
+	app.Get("/redirect", func(c *fiber.Ctx) error {
+		SetRequestID(c, "req-1")
+		return SendErrorWithRedirect(c, "未登录", "/login", 401, fiber.StatusUnauthorized)
+	})
+	for _, target := range []string{"/success", "/error", "/redirect"} {
+		for _, accept := range []string{fiber.MIMEApplicationJSON, "application/x-protobuf"} {
+			req := httptest.NewRequest(fiber.MethodGet, target, nil)
+			req.Header.Set(fiber.HeaderAccept, accept)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result interface{ GetRequestId() string }
+			if accept == fiber.MIMEApplicationJSON {
+				ajax := &AjaxResponse{}
+				err = json.Unmarshal(data, ajax)
+				result = ajax
+			} else {
+				pb := &PBResponse{}
+				err = proto.Unmarshal(data, pb)
+				result = pb
+			}
+			if err != nil || result.GetRequestId() != "req-1" {
+				t.Fatalf("%s %s: 响应应包含请求ID, got %s err=%v", target, accept, data, err)
+			}
+		}
+	}
+}
@@ -3,30 +3,79 @@ package httpxcommons
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/pem"
+	"fmt"
 	"github.com/coffeehc/base/errors"
+	"math/big"
+	"net"
+	"os"
+	"time"
 )
 
 func LoadCertificate(raw []byte) (tls.Certificate, error) {
+	return LoadCertificateWithPassword(raw, "")
+}
+
+// LoadCertificateWithPassword 加载 PEM 格式的证书和私钥,password 用于解密加密的私钥,
+// 支持传统的 Proc-Type 加密和 PKCS8 ENCRYPTED PRIVATE KEY
+func LoadCertificateWithPassword(raw []byte, password string) (tls.Certificate, error) {
 	var cert tls.Certificate
 	for {
 		block, rest := pem.Decode(raw)
 		if block == nil {
 			break
 		}
-		var err error
-		if block.Type == "CERTIFICATE" {
-			cert.Certificate = append(cert.Certificate, block.Bytes)
-		} else {
-			cert.PrivateKey, err = parsePrivateKey(block.Bytes)
+		raw = rest
+		der := block.Bytes
+		var key crypto.PrivateKey
+		switch block.Type {
+		case "CERTIFICATE":
+			cert.Certificate = append(cert.Certificate, der)
+			continue
+		case "EC PARAMETERS":
+			continue
+		case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY":
+			// 传统的 PEM 加密方式已不推荐使用,但仍需要兼容已有的私钥
+			if x509.IsEncryptedPEMBlock(block) {
+				if password == "" {
+					return cert, errors.SystemError("私钥已加密,需要提供密码")
+				}
+				var err error
+				der, err = x509.DecryptPEMBlock(block, []byte(password))
+				if err != nil {
+					return cert, errors.SystemError("解密私钥失败,密码可能错误")
+				}
+			}
+		case "ENCRYPTED PRIVATE KEY":
+			if password == "" {
+				return cert, errors.SystemError("私钥已加密,需要提供密码")
+			}
+			var err error
+			key, err = decryptPKCS8(der, password)
 			if err != nil {
 				return cert, err
 			}
+		default:
+			return cert, errors.SystemError(fmt.Sprintf("不支持的PEM类型%s", block.Type))
 		}
-		raw = rest
+		if cert.PrivateKey != nil {
+			return cert, errors.SystemError("存在多个私钥")
+		}
+		if key == nil {
+			var err error
+			key, err = parsePrivateKey(der)
+			if err != nil {
+				return cert, err
+			}
+		}
+		cert.PrivateKey = key
 	}
 
 	if len(cert.Certificate) == 0 {
@@ -34,7 +83,54 @@ func LoadCertificate(raw []byte) (tls.Certificate, error) {
 	} else if cert.PrivateKey == nil {
 		return cert, errors.SystemError("没有私钥证书")
 	}
-	return cert, nil
+	return cert, checkKeyPair(&cert)
+}
+
+// checkKeyPair 检查私钥与叶子证书是否匹配,并填充 cert.Leaf
+func checkKeyPair(cert *tls.Certificate) error {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return errors.SystemError("解析公钥证书失败")
+	}
+	if !publicKeyMatches(cert.PrivateKey, leaf.PublicKey) {
+		return errors.SystemError("私钥与证书不匹配")
+	}
+	cert.Leaf = leaf
+	return nil
+}
+
+func publicKeyMatches(privateKey crypto.PrivateKey, publicKey crypto.PublicKey) bool {
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return false
+	}
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && pub.Equal(publicKey)
+}
+
+// LoadCertPool 从 PEM 格式的 CA 证书包中加载证书池,用于校验客户端证书
+func LoadCertPool(raw []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	count := 0
+	for {
+		block, rest := pem.Decode(raw)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, errors.SystemError("解析CA证书失败")
+			}
+			pool.AddCert(cert)
+			count++
+		}
+		raw = rest
+	}
+	if count == 0 {
+		return nil, errors.SystemError("没有CA证书")
+	}
+	return pool, nil
 }
 
 func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
@@ -42,15 +138,223 @@ func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
 		return key, nil
 	}
 	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
-		switch key := key.(type) {
-		case *rsa.PrivateKey, *ecdsa.PrivateKey:
-			return key, nil
-		default:
+		if !isSupportedPrivateKey(key) {
 			return nil, errors.SystemError("加载PKCS8私钥失败")
 		}
+		return key, nil
 	}
 	if key, err := x509.ParseECPrivateKey(der); err == nil {
 		return key, nil
 	}
 	return nil, errors.SystemError("无法解析私钥")
 }
+
+type KeyType string
+
+const (
+	KeyTypeECDSA KeyType = "ecdsa"
+	KeyTypeRSA   KeyType = "rsa"
+)
+
+// SelfSignedOptions 自签名证书参数
+type SelfSignedOptions struct {
+	// Hosts 证书包含的域名或IP,为空时默认为 localhost、127.0.0.1 和 ::1
+	Hosts []string
+	// KeyType 私钥类型,默认为 ECDSA P-256
+	KeyType KeyType
+	// Validity 有效期,默认为一年
+	Validity     time.Duration
+	Organization string
+}
+
+// GenerateSelfSignedCertificate 在内存中生成自签名证书,用于本地开发和集成测试,
+// 生成的是终端证书(IsCA 为 false),客户端信任时直接将证书本身加入根证书池
+func GenerateSelfSignedCertificate(opts SelfSignedOptions) (tls.Certificate, error) {
+	var cert tls.Certificate
+	if len(opts.Hosts) == 0 {
+		opts.Hosts = []string{"localhost", "127.0.0.1", "::1"}
+	}
+	if opts.Validity <= 0 {
+		opts.Validity = 365 * 24 * time.Hour
+	}
+	if opts.Organization == "" {
+		opts.Organization = "httpx development"
+	}
+	var privateKey crypto.Signer
+	var err error
+	switch opts.KeyType {
+	case KeyTypeECDSA, "":
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeRSA:
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		return cert, errors.SystemError("不支持的私钥类型")
+	}
+	if err != nil {
+		return cert, err
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return cert, err
+	}
+	notBefore := time.Now().Add(-time.Minute)
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: opts.Hosts[0], Organization: []string{opts.Organization}},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(opts.Validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		// 终端证书不能作为CA使用,部分浏览器会拒绝作为服务端证书的CA证书
+		IsCA: false,
+	}
+	if opts.KeyType == KeyTypeRSA {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	for _, host := range opts.Hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, privateKey.Public(), privateKey)
+	if err != nil {
+		return cert, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return cert, err
+	}
+	cert.Certificate = [][]byte{der}
+	cert.PrivateKey = privateKey
+	cert.Leaf = leaf
+	return cert, nil
+}
+
+// EncodeCertificatePEM 将证书链和私钥编码为PEM,私钥使用PKCS8格式
+func EncodeCertificatePEM(cert tls.Certificate) (certPEM []byte, keyPEM []byte, err error) {
+	for _, der := range cert.Certificate {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return certPEM, keyPEM, nil
+}
+
+// WriteCertificatePEM 将证书和私钥写入磁盘,keyFile 为空时私钥追加写入 certFile
+func WriteCertificatePEM(cert tls.Certificate, certFile, keyFile string) error {
+	certPEM, keyPEM, err := EncodeCertificatePEM(cert)
+	if err != nil {
+		return err
+	}
+	if keyFile == "" {
+		return os.WriteFile(certFile, append(certPEM, keyPEM...), 0600)
+	}
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(keyFile, keyPEM, 0600)
+}
+
+// CertificateInfo 证书的基本信息,用于展示和过期检查
+type CertificateInfo struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serial_number"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	DNSNames     []string  `json:"dns_names,omitempty"`
+	IPAddresses  []string  `json:"ip_addresses,omitempty"`
+	URIs         []string  `json:"uris,omitempty"`
+	KeyType      string    `json:"key_type"`
+}
+
+// ExpiresIn 返回距离过期的时间,已过期时为负数
+func (info *CertificateInfo) ExpiresIn() time.Duration {
+	return time.Until(info.NotAfter)
+}
+
+// ExpiresInSeconds 返回距离过期的秒数,便于作为监控指标上报
+func (info *CertificateInfo) ExpiresInSeconds() float64 {
+	return info.ExpiresIn().Seconds()
+}
+
+// IsExpiringWithin 判断证书是否会在 threshold 内过期
+func (info *CertificateInfo) IsExpiringWithin(threshold time.Duration) bool {
+	return info.ExpiresIn() < threshold
+}
+
+// InspectCertificate 解析叶子证书的有效期、SAN和密钥类型
+func InspectCertificate(cert tls.Certificate) (*CertificateInfo, error) {
+	leaf := cert.Leaf
+	if leaf == nil {
+		if len(cert.Certificate) == 0 {
+			return nil, errors.SystemError("没有公钥证书")
+		}
+		var err error
+		leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, errors.SystemError("解析公钥证书失败")
+		}
+	}
+	info := &CertificateInfo{
+		Subject:      leaf.Subject.String(),
+		Issuer:       leaf.Issuer.String(),
+		SerialNumber: leaf.SerialNumber.Text(16),
+		NotBefore:    leaf.NotBefore,
+		NotAfter:     leaf.NotAfter,
+		DNSNames:     leaf.DNSNames,
+		KeyType:      publicKeyType(leaf.PublicKey),
+	}
+	for _, ip := range leaf.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	for _, uri := range leaf.URIs {
+		info.URIs = append(info.URIs, uri.String())
+	}
+	return info, nil
+}
+
+func publicKeyType(publicKey crypto.PublicKey) string {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return "unknown"
+	}
+}
+
+// VerifyCertificateChain 使用 roots 校验证书链,证书链中除叶子外的证书作为中间证书,
+// roots 为空时使用系统根证书
+func VerifyCertificateChain(cert tls.Certificate, roots *x509.CertPool) error {
+	if len(cert.Certificate) == 0 {
+		return errors.SystemError("没有公钥证书")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return errors.SystemError("解析公钥证书失败")
+	}
+	intermediates := x509.NewCertPool()
+	for _, der := range cert.Certificate[1:] {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return errors.SystemError("解析中间证书失败")
+		}
+		intermediates.AddCert(c)
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	return err
+}
@@ -0,0 +1,338 @@
+package httpxcommons
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/youmark/pkcs8"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testIssuer 测试用的证书和私钥,用于签发下一级证书
+type testIssuer struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issueCertificate 由 parent 签发证书,parent 为空时生成自签名证书
+func issueCertificate(t *testing.T, parent *testIssuer, template *x509.Certificate) *testIssuer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialNumber, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = serialNumber
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = time.Now().Add(24 * time.Hour)
+	}
+	if template.IsCA {
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, key.Public(), signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testIssuer{cert: cert, key: key}
+}
+
+// certificateChain 返回以 leaf 开头、依次包含 intermediates 的 tls.Certificate
+func certificateChain(leaf *testIssuer, intermediates ...*testIssuer) tls.Certificate {
+	cert := tls.Certificate{Certificate: [][]byte{leaf.cert.Raw}, PrivateKey: leaf.key, Leaf: leaf.cert}
+	for _, intermediate := range intermediates {
+		cert.Certificate = append(cert.Certificate, intermediate.cert.Raw)
+	}
+	return cert
+}
+
+func certPool(issuers ...*testIssuer) *x509.CertPool {
+	pool := x509.NewCertPool()
+	for _, issuer := range issuers {
+		pool.AddCert(issuer.cert)
+	}
+	return pool
+}
+
+func TestInspectCertificate(t *testing.T) {
+	root := issueCertificate(t, nil, &x509.Certificate{Subject: pkix.Name{CommonName: "root"}, IsCA: true})
+	uri, _ := url.Parse("spiffe://example.com/service")
+	leaf := issueCertificate(t, root, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "service"},
+		DNSNames:    []string{"service.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+		URIs:        []*url.URL{uri},
+	})
+	cert := certificateChain(leaf)
+	// 没有 Leaf 时从证书链中解析
+	cert.Leaf = nil
+	info, err := InspectCertificate(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Subject != "CN=service" || info.Issuer != "CN=root" || info.KeyType != "ECDSA-P-256" || info.SerialNumber != leaf.cert.SerialNumber.Text(16) {
+		t.Fatalf("got %+v", info)
+	}
+	if len(info.DNSNames) != 1 || len(info.IPAddresses) != 1 || info.IPAddresses[0] != "10.0.0.1" || len(info.URIs) != 1 || info.URIs[0] != uri.String() {
+		t.Fatalf("SAN 不正确: %+v", info)
+	}
+	if !info.NotAfter.Equal(leaf.cert.NotAfter) || !info.NotBefore.Equal(leaf.cert.NotBefore) {
+		t.Fatalf("有效期不正确: %+v", info)
+	}
+	rsaCert, err := GenerateSelfSignedCertificate(SelfSignedOptions{KeyType: KeyTypeRSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := InspectCertificate(rsaCert); err != nil || info.KeyType != "RSA-2048" {
+		t.Fatalf("info=%+v err=%v", info, err)
+	}
+	if _, err := InspectCertificate(tls.Certificate{}); err == nil {
+		t.Fatal("空证书应返回错误")
+	}
+	if _, err := InspectCertificate(tls.Certificate{Certificate: [][]byte{[]byte("invalid")}}); err == nil {
+		t.Fatal("无法解析的证书应返回错误")
+	}
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	cases := []struct {
+		name     string
+		notAfter time.Time
+		within   time.Duration
+		expiring bool
+		expired  bool
+	}{
+		{"即将过期", time.Now().Add(24 * time.Hour), 30 * 24 * time.Hour, true, false},
+		{"未到告警时间", time.Now().Add(24 * time.Hour), time.Hour, false, false},
+		{"有效期充足", time.Now().Add(365 * 24 * time.Hour), 30 * 24 * time.Hour, false, false},
+		{"已过期", time.Now().Add(-time.Minute), 0, true, true},
+	}
+	for _, tc := range cases {
+		leaf := issueCertificate(t, nil, &x509.Certificate{Subject: pkix.Name{CommonName: "expiry"}, NotBefore: time.Now().Add(-48 * time.Hour), NotAfter: tc.notAfter})
+		info, err := InspectCertificate(certificateChain(leaf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.IsExpiringWithin(tc.within) != tc.expiring {
+			t.Fatalf("%s: IsExpiringWithin(%s)=%v", tc.name, tc.within, !tc.expiring)
+		}
+		if expired := info.ExpiresIn() < 0; expired != tc.expired {
+			t.Fatalf("%s: ExpiresIn=%s", tc.name, info.ExpiresIn())
+		}
+		if diff := info.ExpiresInSeconds() - time.Until(tc.notAfter).Seconds(); diff > 2 || diff < -2 {
+			t.Fatalf("%s: ExpiresInSeconds=%f", tc.name, info.ExpiresInSeconds())
+		}
+	}
+}
+
+func TestVerifyCertificateChain(t *testing.T) {
+	root := issueCertificate(t, nil, &x509.Certificate{Subject: pkix.Name{CommonName: "root"}, IsCA: true})
+	otherRoot := issueCertificate(t, nil, &x509.Certificate{Subject: pkix.Name{CommonName: "root"}, IsCA: true})
+	intermediate := issueCertificate(t, root, &x509.Certificate{Subject: pkix.Name{CommonName: "intermediate"}, IsCA: true})
+	leaf := func(template *x509.Certificate) *testIssuer {
+		template.Subject = pkix.Name{CommonName: "service"}
+		template.DNSNames = []string{"service.example.com"}
+		return issueCertificate(t, intermediate, template)
+	}
+	valid := leaf(&x509.Certificate{})
+	cases := []struct {
+		name  string
+		cert  tls.Certificate
+		roots *x509.CertPool
+		ok    bool
+	}{
+		{"中间证书链有效", certificateChain(valid, intermediate), certPool(root), true},
+		{"缺少中间证书", certificateChain(valid), certPool(root), false},
+		{"根证书不匹配", certificateChain(valid, intermediate), certPool(otherRoot), false},
+		{"已过期", certificateChain(leaf(&x509.Certificate{NotBefore: time.Now().Add(-48 * time.Hour), NotAfter: time.Now().Add(-time.Hour)}), intermediate), certPool(root), false},
+		{"尚未生效", certificateChain(leaf(&x509.Certificate{NotBefore: time.Now().Add(time.Hour), NotAfter: time.Now().Add(48 * time.Hour)}), intermediate), certPool(root), false},
+		{"空证书", tls.Certificate{}, certPool(root), false},
+	}
+	for _, tc := range cases {
+		if err := VerifyCertificateChain(tc.cert, tc.roots); (err == nil) != tc.ok {
+			t.Fatalf("%s: err=%v", tc.name, err)
+		}
+	}
+}
+
+func TestGenerateSelfSignedCertificate(t *testing.T) {
+	cases := []struct {
+		opts    SelfSignedOptions
+		keyType string
+		dns     []string
+		ips     []string
+	}{
+		{SelfSignedOptions{}, "ECDSA-P-256", []string{"localhost"}, []string{"127.0.0.1", "::1"}},
+		{SelfSignedOptions{Hosts: []string{"api.example.com", "10.0.0.1"}, KeyType: KeyTypeRSA, Validity: 48 * time.Hour}, "RSA-2048", []string{"api.example.com"}, []string{"10.0.0.1"}},
+	}
+	for _, tc := range cases {
+		cert, err := GenerateSelfSignedCertificate(tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf := cert.Leaf
+		// 生成的是终端证书,不能用于签发其它证书
+		if leaf.IsCA || !leaf.BasicConstraintsValid || leaf.KeyUsage&x509.KeyUsageCertSign != 0 {
+			t.Fatalf("IsCA=%v KeyUsage=%b", leaf.IsCA, leaf.KeyUsage)
+		}
+		if _, isRSA := cert.PrivateKey.(*rsa.PrivateKey); isRSA != (leaf.KeyUsage&x509.KeyUsageKeyEncipherment != 0) {
+			t.Fatalf("只有 RSA 证书需要 KeyEncipherment, KeyUsage=%b", leaf.KeyUsage)
+		}
+		info, err := InspectCertificate(cert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.KeyType != tc.keyType || !equalStrings(info.DNSNames, tc.dns) || !equalStrings(info.IPAddresses, tc.ips) {
+			t.Fatalf("got %+v", info)
+		}
+		validity := tc.opts.Validity
+		if validity == 0 {
+			validity = 365 * 24 * time.Hour
+		}
+		if got := leaf.NotAfter.Sub(leaf.NotBefore); got != validity {
+			t.Fatalf("有效期应为%s, got %s", validity, got)
+		}
+		// 证书本身加入根证书池后可以通过校验
+		if err := VerifyCertificateChain(cert, certPool(&testIssuer{cert: leaf})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := GenerateSelfSignedCertificate(SelfSignedOptions{KeyType: "dsa"}); err == nil {
+		t.Fatal("不支持的私钥类型应返回错误")
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 生成、写入磁盘、再加载的证书与原证书一致
+func TestWriteCertificatePEMRoundTrip(t *testing.T) {
+	for _, keyType := range []KeyType{KeyTypeECDSA, KeyTypeRSA} {
+		cert, err := GenerateSelfSignedCertificate(SelfSignedOptions{KeyType: keyType})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		certFile, keyFile, bundleFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "tls.pem")
+		if err := WriteCertificatePEM(cert, certFile, keyFile); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteCertificatePEM(cert, bundleFile, ""); err != nil {
+			t.Fatal(err)
+		}
+		certPEM, keyPEM := readFile(t, certFile), readFile(t, keyFile)
+		if info, _ := os.Stat(keyFile); info.Mode().Perm() != 0600 {
+			t.Fatalf("私钥文件权限应为0600, got %o", info.Mode().Perm())
+		}
+		if bytes.Contains(certPEM, []byte("PRIVATE KEY")) {
+			t.Fatal("证书文件不应包含私钥")
+		}
+		for name, raw := range map[string][]byte{"分开的文件": append(certPEM, keyPEM...), "合并的文件": readFile(t, bundleFile)} {
+			loaded, err := LoadCertificate(raw)
+			if err != nil {
+				t.Fatalf("%s %s: %v", keyType, name, err)
+			}
+			if !bytes.Equal(loaded.Certificate[0], cert.Certificate[0]) || !loaded.Leaf.Equal(cert.Leaf) {
+				t.Fatalf("%s %s: 加载的证书与原证书不一致", keyType, name)
+			}
+			if !publicKeyMatches(loaded.PrivateKey, cert.Leaf.PublicKey) {
+				t.Fatalf("%s %s: 私钥不一致", keyType, name)
+			}
+		}
+	}
+}
+
+func readFile(t *testing.T, file string) []byte {
+	t.Helper()
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// 加密的私钥使用正确的密码可以加载,密码错误或没有密码时返回错误
+func TestLoadCertificateWithPasswordGenerated(t *testing.T) {
+	cert, err := GenerateSelfSignedCertificate(SelfSignedOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, _, err := EncodeCertificatePEM(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8Key, err := pkcs8.MarshalPrivateKey(cert.PrivateKey, []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 传统的 Proc-Type 加密方式已不推荐使用,仍需要能够加载
+	legacyBlock, err := x509.EncryptPEMBlock(rand.Reader, "EC PRIVATE KEY", ecKey, []byte("secret"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string][]byte{
+		"PKCS8":     pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: pkcs8Key}),
+		"Proc-Type": pem.EncodeToMemory(legacyBlock),
+	}
+	for name, keyPEM := range keys {
+		raw := append(append([]byte(nil), certPEM...), keyPEM...)
+		loaded, err := LoadCertificateWithPassword(raw, "secret")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !publicKeyMatches(loaded.PrivateKey, cert.Leaf.PublicKey) {
+			t.Fatalf("%s: 私钥不一致", name)
+		}
+		if _, err := LoadCertificateWithPassword(raw, "wrong"); err == nil {
+			t.Fatalf("%s: 密码错误时应返回错误", name)
+		}
+		if _, err := LoadCertificate(raw); err == nil {
+			t.Fatalf("%s: 没有密码时应返回错误", name)
+		}
+	}
+	if _, err := LoadCertificate(certPEM); err == nil {
+		t.Fatal("没有私钥时应返回错误")
+	}
+}
@@ -1,7 +1,7 @@
 package httpxcommons
 
 import (
-	"github.com/coffeehc/base/errors"
+	es "errors"
 	"github.com/coffeehc/base/log"
 	"github.com/gofiber/fiber/v2"
 	"go.uber.org/zap"
@@ -22,9 +22,10 @@ func SendPBSuccess(c *fiber.Ctx, obj interface{}, code int64) error {
 		return err
 	}
 	resp := &PBResponse{
-		Code:    code,
-		Success: true,
-		Payload: data,
+		Code:      code,
+		Success:   true,
+		Payload:   data,
+		RequestId: GetRequestID(c),
 	}
 	data, err = proto.Marshal(resp)
 	if err != nil {
@@ -58,9 +59,10 @@ func SendSuccess(c *fiber.Ctx, obj interface{}, code int64) error {
 			data = []byte(message)
 		}
 		resp := &PBResponse{
-			Code:    code,
-			Success: true,
-			Payload: data,
+			Code:      code,
+			Success:   true,
+			Payload:   data,
+			RequestId: GetRequestID(c),
 		}
 		data, err = proto.Marshal(resp)
 		if err != nil {
@@ -70,17 +72,19 @@ func SendSuccess(c *fiber.Ctx, obj interface{}, code int64) error {
 		return c.Status(200).Send(data)
 	}
 	return c.JSON(&AjaxResponse{
-		Code:    code,
-		Payload: obj,
-		Success: true,
+		Code:      code,
+		Payload:   obj,
+		Success:   true,
+		RequestID: GetRequestID(c),
 	})
 }
 
 func SendErrorWithRedirect(c *fiber.Ctx, message string, redirect string, code int64, statusCode int) error {
 	if !strings.Contains(c.Get(fiber.HeaderAccept), "*/*") && c.Accepts("application/x-protobuf") != "" {
 		resp := &PBResponse{
-			Code:    code,
-			Message: message,
+			Code:      code,
+			Message:   message,
+			RequestId: GetRequestID(c),
 		}
 		data, err := proto.Marshal(resp)
 		if err != nil {
@@ -91,17 +95,21 @@ func SendErrorWithRedirect(c *fiber.Ctx, message string, redirect string, code i
 
 	}
 	return c.Status(statusCode).JSON(&AjaxResponse{
-		Code:     code,
-		Message:  message,
-		Redirect: redirect,
+		Code:      code,
+		Message:   message,
+		Redirect:  redirect,
+		RequestID: GetRequestID(c),
 	})
 } //(c, "", "/user/login", 401, 401)
 
-func SendError(c *fiber.Ctx, err string, code int64, statusCode int) error {
+// SendError 输出错误,fieldErrors 为参数校验失败的字段错误列表
+func SendError(c *fiber.Ctx, err string, code int64, statusCode int, fieldErrors ...*FieldError) error {
 	if !strings.Contains(c.Get(fiber.HeaderAccept), "*/*") && c.Accepts("application/x-protobuf") != "" {
 		resp := &PBResponse{
-			Code:    code,
-			Message: err,
+			Code:      code,
+			Message:   err,
+			Errors:    fieldErrors,
+			RequestId: GetRequestID(c),
 		}
 		data, err := proto.Marshal(resp)
 		if err != nil {
@@ -113,31 +121,26 @@ func SendError(c *fiber.Ctx, err string, code int64, statusCode int) error {
 
 	}
 	return c.Status(statusCode).JSON(&AjaxResponse{
-		Code:    code,
-		Message: err,
+		Code:      code,
+		Message:   err,
+		Errors:    fieldErrors,
+		RequestID: GetRequestID(c),
 	})
 }
 
+// SendErrors 使用指定的业务码和状态码输出错误,返回给客户端的信息由错误转换规则决定,
+// 与 MapError 一致,没有规则匹配时返回"系统内部错误",不输出错误本身的信息
 func SendErrors(c *fiber.Ctx, err error, code int64, statusCode int) error {
-	message := err.Error()
-	if errors.IsSystemError(err) || errors.IsDBError(err) {
-		message = "系统内部错误"
-	}
-	if !strings.Contains(c.Get(fiber.HeaderAccept), "*/*") && c.Accepts("application/x-protobuf") != "" {
-		resp := &PBResponse{
-			Code:    code,
-			Message: message,
-		}
-		data, err := proto.Marshal(resp)
-		if err != nil {
-			log.Error("错误", zap.Error(err))
-			return c.SendStatus(500)
-		}
-		return c.Status(statusCode).Send(data)
-	}
+	message := MapError(err).Message
+	var fieldErrors ValidationErrors
+	es.As(err, &fieldErrors)
+	return SendError(c, message, code, statusCode, fieldErrors...)
+}
 
-	return c.Status(statusCode).JSON(&AjaxResponse{
-		Code:    code,
-		Message: message,
-	})
+// SendMappedError 按错误转换规则(见 RegisterErrorMapper)确定状态码、业务码和信息后输出错误
+func SendMappedError(c *fiber.Ctx, err error) error {
+	mapping := MapError(err)
+	var fieldErrors ValidationErrors
+	es.As(err, &fieldErrors)
+	return SendError(c, mapping.Message, mapping.Code, mapping.StatusCode, fieldErrors...)
 }
@@ -0,0 +1,21 @@
+package httpx
+
+import (
+	"github.com/coffeehc/base/log"
+	"go.uber.org/zap"
+)
+
+type logFunc func(msg string, fields ...zap.Field)
+
+// levelLogger 按级别输出日志,用于可以在配置中替换 logger 的中间件
+type levelLogger struct {
+	debug, info, warn, error, dpanic logFunc
+}
+
+// newLevelLogger logger 为空时使用 coffeehc/base/log
+func newLevelLogger(logger *zap.Logger) *levelLogger {
+	if logger == nil {
+		return &levelLogger{debug: log.Debug, info: log.Info, warn: log.Warn, error: log.Error, dpanic: log.DPanic}
+	}
+	return &levelLogger{debug: logger.Debug, info: logger.Info, warn: logger.Warn, error: logger.Error, dpanic: logger.DPanic}
+}
@@ -0,0 +1,163 @@
+package httpx
+
+import (
+	"bytes"
+	es "errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// DefaultLatencyBuckets 请求耗时直方图的默认分桶(秒)
+	DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	// DefaultSizeBuckets 请求和响应大小直方图的默认分桶(字节)
+	DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+)
+
+// routeUnmatched 没有匹配到路由的请求统一使用的路由标签,避免原始路径导致标签数量膨胀
+const routeUnmatched = "unmatched"
+
+// Metrics 按路由模板、请求方法和状态码分类(2xx、4xx等)统计请求,使用 prometheus/client_golang 的 CounterVec 和 HistogramVec,
+// 所有指标带有 app 标签,可以与进程中的其它指标共用同一个 Registry
+type Metrics struct {
+	gatherer     prometheus.Gatherer
+	inFlight     prometheus.Gauge
+	requests     *prometheus.CounterVec
+	latency      *prometheus.HistogramVec
+	requestSize  *prometheus.HistogramVec
+	responseSize *prometheus.HistogramVec
+}
+
+// NewMetrics 创建请求指标并注册到 prometheus.DefaultRegisterer,/metrics 同时输出默认 Registry 中的
+// go_ 和 process_ 指标以及其它代码注册的指标
+func NewMetrics(appName string) (*Metrics, error) {
+	return NewMetricsWithRegistry(appName, prometheus.DefaultRegisterer, prometheus.DefaultGatherer)
+}
+
+// NewMetricsWithRegistry 创建请求指标并注册到 registerer,/metrics 输出 gatherer 中的所有指标,
+// 同一个 Registry 中已经注册过的同名同 app 指标直接复用
+func NewMetricsWithRegistry(appName string, registerer prometheus.Registerer, gatherer prometheus.Gatherer) (*Metrics, error) {
+	constLabels := prometheus.Labels{"app": appName}
+	labels := []string{"method", "route", "status"}
+	histogram := func(name, help string, buckets []float64) *prometheus.HistogramVec {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, ConstLabels: constLabels, Buckets: buckets}, labels)
+	}
+	impl := &Metrics{gatherer: gatherer}
+	var err error
+	if impl.inFlight, err = registerCollector(registerer, prometheus.NewGauge(prometheus.GaugeOpts{Name: "http_requests_in_flight", Help: "当前正在处理的请求数", ConstLabels: constLabels})); err != nil {
+		return nil, err
+	}
+	if impl.requests, err = registerCollector(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{Name: "http_requests_total", Help: "请求总数", ConstLabels: constLabels}, labels)); err != nil {
+		return nil, err
+	}
+	if impl.latency, err = registerCollector(registerer, histogram("http_request_duration_seconds", "请求耗时(秒)", DefaultLatencyBuckets)); err != nil {
+		return nil, err
+	}
+	if impl.requestSize, err = registerCollector(registerer, histogram("http_request_size_bytes", "请求体大小(字节)", DefaultSizeBuckets)); err != nil {
+		return nil, err
+	}
+	if impl.responseSize, err = registerCollector(registerer, histogram("http_response_size_bytes", "响应体大小(字节)", DefaultSizeBuckets)); err != nil {
+		return nil, err
+	}
+	return impl, nil
+}
+
+// registerCollector 注册 collector,已经注册过相同的指标时返回已注册的 collector
+func registerCollector[T prometheus.Collector](registerer prometheus.Registerer, collector T) (T, error) {
+	if err := registerer.Register(collector); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if es.As(err, &registered) {
+			if existing, ok := registered.ExistingCollector.(T); ok {
+				return existing, nil
+			}
+		}
+		return collector, err
+	}
+	return collector, nil
+}
+
+// Middleware 返回统计请求的中间件,应在注册路由之前通过 Use 挂载
+func (impl *Metrics) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		entry := c.Route()
+		start := time.Now()
+		impl.inFlight.Inc()
+		defer impl.inFlight.Dec()
+		err := c.Next()
+		status := responseStatus(c, err)
+		labels := prometheus.Labels{"method": strings.Clone(c.Method()), "route": routeTemplate(c, entry, err), "status": statusClass(status)}
+		impl.requests.With(labels).Inc()
+		impl.latency.With(labels).Observe(time.Since(start).Seconds())
+		impl.requestSize.With(labels).Observe(float64(requestSize(c)))
+		impl.responseSize.With(labels).Observe(float64(responseSize(c)))
+		return err
+	}
+}
+
+// routeTemplate 返回请求匹配到的路由模板,entry 为调用 c.Next() 之前中间件自身的路由,
+// 之后的路由没有变化或者 fiber 返回了未匹配路由的错误时返回 unmatched
+func routeTemplate(c *fiber.Ctx, entry *fiber.Route, err error) string {
+	route := c.Route()
+	var fiberErr *fiber.Error
+	if route == entry || (es.As(err, &fiberErr) && fiberErr.Code == fiber.StatusNotFound && strings.HasPrefix(fiberErr.Message, "Cannot "+c.Method())) {
+		return routeUnmatched
+	}
+	return route.Path
+}
+
+func requestSize(c *fiber.Ctx) int {
+	if n := c.Request().Header.ContentLength(); n >= 0 {
+		return n
+	}
+	if c.Request().IsBodyStream() {
+		return 0
+	}
+	return len(c.Request().Body())
+}
+
+// responseSize 返回响应体大小。流式响应(如 SSE)不能调用 Body(),否则会在中间件中读完整个流,
+// 只在设置了 Content-Length 时返回该长度,否则返回0
+func responseSize(c *fiber.Ctx) int {
+	if c.Response().IsBodyStream() {
+		if n := c.Response().Header.ContentLength(); n > 0 {
+			return n
+		}
+		return 0
+	}
+	return len(c.Response().Body())
+}
+
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// Handler 返回输出 Prometheus 指标的处理器,按 Accept 请求头协商文本格式或 OpenMetrics 格式
+func (impl *Metrics) Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(impl.gatherer, promhttp.HandlerOpts{}))
+}
+
+// Register 在 router 上挂载 /metrics
+func (impl *Metrics) Register(router fiber.Router) {
+	router.Get("/metrics", impl.Handler())
+}
+
+// Expose 按 Prometheus 文本格式输出 gatherer 中的所有指标
+func (impl *Metrics) Expose() ([]byte, error) {
+	families, err := impl.gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(buf, family); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,256 @@
+package httpx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	es "errors"
+	"fmt"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer 并发安全的 bytes.Buffer
+type lockedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+// serveApp 在随机端口上启动 app,返回访问地址
+func newTestMetrics(t *testing.T, appName string, registry *prometheus.Registry) *Metrics {
+	t.Helper()
+	metrics, err := NewMetricsWithRegistry(appName, registry, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metrics
+}
+
+func expose(t *testing.T, metrics *Metrics) string {
+	t.Helper()
+	data, err := metrics.Expose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func serveApp(t *testing.T, app *fiber.App) string {
+	t.Helper()
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() {
+		app.Shutdown()
+	})
+	return "http://" + ln.Addr().String()
+}
+
+// SSE 等流式响应在中间件中不能被读完,客户端应在流结束前收到第一个事件
+func TestMetricsStreamedResponse(t *testing.T) {
+	metrics := newTestMetrics(t, "test", prometheus.NewRegistry())
+	combined := &lockedBuffer{}
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(metrics.Middleware())
+	app.Use(AccessLogMiddlewareWithConfig(AccessLogConfig{CombinedWriter: combined}))
+	release := make(chan struct{})
+	app.Get("/events", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, "text/event-stream")
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			w.WriteString("data: 1\n\n")
+			w.Flush()
+			<-release
+			w.WriteString("data: 2\n\n")
+			w.Flush()
+		})
+		return nil
+	})
+	base := serveApp(t, app)
+	resp, err := http.Get(base + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	first := make(chan string, 1)
+	reader := bufio.NewReader(resp.Body)
+	go func() {
+		line, _ := reader.ReadString('\n')
+		first <- line
+	}()
+	select {
+	case line := <-first:
+		if line != "data: 1\n" {
+			t.Fatalf("got %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		close(release)
+		t.Fatal("流结束前没有收到第一个事件")
+	}
+	close(release)
+	rest, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(rest), "data: 2") {
+		t.Fatalf("got %q", rest)
+	}
+	exposed := expose(t, metrics)
+	if !strings.Contains(exposed, `http_response_size_bytes_count{app="test",method="GET",route="/events",status="2xx"} 1`) {
+		t.Fatalf("没有记录流式响应:\n%s", exposed)
+	}
+	if line := combined.String(); !strings.Contains(line, `"GET /events HTTP/1.1" 200 - `) {
+		t.Fatalf("流式响应的大小应输出为 -, got %q", line)
+	}
+}
+
+func TestMetricsRouteTemplate(t *testing.T) {
+	metrics := newTestMetrics(t, "test", prometheus.NewRegistry())
+	app := fiber.New()
+	app.Use(metrics.Middleware())
+	app.Get("/users/:id", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	for _, target := range []string{"/users/1", "/users/2", "/missing"} {
+		if _, err := app.Test(httptest.NewRequest(fiber.MethodGet, target, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exposed := expose(t, metrics)
+	for _, want := range []string{
+		`http_requests_total{app="test",method="GET",route="/users/:id",status="2xx"} 2`,
+		`http_requests_total{app="test",method="GET",route="unmatched",status="4xx"} 1`,
+		`http_response_size_bytes_sum{app="test",method="GET",route="/users/:id",status="2xx"} 4`,
+	} {
+		if !strings.Contains(exposed, want) {
+			t.Fatalf("缺少 %s:\n%s", want, exposed)
+		}
+	}
+}
+
+// 处理器返回的错误按错误转换规则记录状态码,与客户端收到的一致
+func TestMetricsErrorStatus(t *testing.T) {
+	metrics := newTestMetrics(t, "test", prometheus.NewRegistry())
+	app := fiber.New(fiber.Config{ErrorHandler: DefaultErrorHandler})
+	app.Use(metrics.Middleware())
+	errs := map[string]error{
+		"/invalid": httpxcommons.ValidationErrors{{Field: "name", Message: "不能为空"}},
+		"/timeout": fmt.Errorf("查询超时: %w", context.DeadlineExceeded),
+		"/teapot":  fiber.ErrTeapot,
+		"/failed":  es.New("failed"),
+	}
+	for path, err := range errs {
+		err := err
+		app.Get(path, func(c *fiber.Ctx) error {
+			return err
+		})
+	}
+	want := map[string]int{"/invalid": fiber.StatusBadRequest, "/timeout": fiber.StatusRequestTimeout, "/teapot": fiber.StatusTeapot, "/failed": fiber.StatusInternalServerError}
+	for path, status := range want {
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != status {
+			t.Fatalf("%s: status=%d", path, resp.StatusCode)
+		}
+	}
+	exposed := expose(t, metrics)
+	for path, status := range want {
+		series := fmt.Sprintf(`http_requests_total{app="test",method="GET",route="%s",status="%s"} 1`, path, statusClass(status))
+		if !strings.Contains(exposed, series) {
+			t.Fatalf("缺少 %s:\n%s", series, exposed)
+		}
+	}
+}
+
+// 默认 Registry 中包含 go_ 和 process_ 指标,/metrics 一起输出
+func TestMetricsDefaultRegistry(t *testing.T) {
+	metrics, err := NewMetrics("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	app.Use(metrics.Middleware())
+	metrics.Register(app)
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/metrics", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	exposed := string(data)
+	if resp.StatusCode != fiber.StatusOK || !strings.HasPrefix(resp.Header.Get(fiber.HeaderContentType), "text/plain") {
+		t.Fatalf("status=%d content-type=%s", resp.StatusCode, resp.Header.Get(fiber.HeaderContentType))
+	}
+	wants := []string{"go_goroutines ", `http_requests_in_flight{app="default"} 1`}
+	if runtime.GOOS == "linux" {
+		wants = append(wants, "process_cpu_seconds_total ")
+	}
+	for _, want := range wants {
+		if !strings.Contains(exposed, want) {
+			t.Fatalf("缺少 %s:\n%s", want, exposed)
+		}
+	}
+	// 同一个 Registry 中再次创建同名应用的指标时复用已注册的指标
+	if _, err := NewMetrics("default"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 多个应用共用一个 Registry 时按 app 标签区分
+func TestMetricsSharedRegistry(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "custom_total", Help: "业务指标"})
+	registry.MustRegister(counter)
+	counter.Inc()
+	for _, appName := range []string{"a", "b", "a"} {
+		metrics := newTestMetrics(t, appName, registry)
+		app := fiber.New()
+		app.Use(metrics.Middleware())
+		app.Get("/", func(c *fiber.Ctx) error {
+			return nil
+		})
+		if _, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exposed := expose(t, newTestMetrics(t, "a", registry))
+	for _, want := range []string{
+		`http_requests_total{app="a",method="GET",route="/",status="2xx"} 2`,
+		`http_requests_total{app="b",method="GET",route="/",status="2xx"} 1`,
+		"custom_total 1",
+	} {
+		if !strings.Contains(exposed, want) {
+			t.Fatalf("缺少 %s:\n%s", want, exposed)
+		}
+	}
+	// 与已注册指标的标签不一致时返回错误
+	conflict := prometheus.NewRegistry()
+	conflict.MustRegister(prometheus.NewCounterVec(prometheus.CounterOpts{Name: "http_requests_total", Help: "请求总数"}, []string{"path"}))
+	if _, err := NewMetricsWithRegistry("a", conflict, conflict); err == nil {
+		t.Fatal("指标冲突时应返回错误")
+	}
+}
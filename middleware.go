@@ -3,58 +3,143 @@ package httpx
 import (
 	"context"
 	es "errors"
+	"fmt"
 	"github.com/coffeehc/base/errors"
 	"github.com/coffeehc/base/log"
+	"github.com/coffeehc/httpx/httpxcommons"
 	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"runtime/debug"
 	"strings"
 	"time"
 )
 
-func AccessLogMiddleware() fiber.Handler {
+// PanicHook 在恢复 panic 后调用,可用于告警,recovered 为 panic 的值,stack 为发生 panic 的协程栈
+type PanicHook func(c *fiber.Ctx, recovered interface{}, stack []byte)
+
+// RecoveryConfig panic 恢复配置
+type RecoveryConfig struct {
+	PanicHook PanicHook
+	// DisableStackTrace 不在日志中输出调用栈
+	DisableStackTrace bool
+	// Logger 记录 panic 的 logger,为空时使用 coffeehc/base/log
+	Logger *zap.Logger
+}
+
+// RecoverMiddleware 等价于依次使用 RecoveryMiddleware 和 ContextTimeoutMiddleware
+func RecoverMiddleware(t time.Duration) fiber.Handler {
+	config := RecoveryConfig{}
 	return func(c *fiber.Ctx) error {
-		t := time.Now()
-		e := c.Next()
-		if e == nil {
-			log.Debug(c.Path(), zap.Duration("times", time.Since(t)), zap.String("method", c.Method()))
-		} else {
-			log.Error("HTTP访问", zap.Duration("times", time.Since(t)), zap.String("mothod", c.Method()), zap.String("path", c.Path()), zap.Int("status", c.Response().StatusCode()))
-		}
-		return e
+		return recoverPanic(c, &config, func() error {
+			return withContextTimeout(c, t, c.Next)
+		})
 	}
 }
 
-func RecoverMiddleware(t time.Duration) fiber.Handler {
+// RecoveryMiddleware 恢复处理器中的 panic,记录调用栈和请求ID,
+// 并按协商的编码(AjaxResponse 或 PBResponse)返回500错误
+func RecoveryMiddleware(config RecoveryConfig) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		timeoutContext, cancel := context.WithTimeout(c.UserContext(), t)
-		defer func() {
-			cancel()
-			if err := recover(); err != nil {
-				path := c.Path()
-				if errStr, ok := err.(string); ok {
-					log.DPanic(errStr, zap.String("method", c.Method()), zap.String("path", path))
-				} else {
-					e := errors.ConverUnknowError(err)
-					if errors.IsMessageError(e) {
-						log.Error(e.Error(), zap.String("method", c.Method()), zap.String("path", path))
-					} else {
-						if strings.HasPrefix(e.Error(), "context ") || strings.HasPrefix(e.Error(), "rpc error") {
-							log.Error(e.Error(), zap.String("method", c.Method()), zap.String("path", path))
-						} else {
-							log.DPanic(e.Error(), zap.String("method", c.Method()), zap.String("path", path))
-						}
-					}
-				}
-				c.SendStatus(500)
-			}
-		}()
-		c.SetUserContext(timeoutContext)
-		err := c.Next()
-		if err != nil {
-			if es.Is(err, context.DeadlineExceeded) {
-				return fiber.ErrRequestTimeout
-			}
+		return recoverPanic(c, &config, c.Next)
+	}
+}
+
+// ContextTimeoutMiddleware 为 c.UserContext() 设置超时时间,处理器返回 context.DeadlineExceeded 时转换为408
+func ContextTimeoutMiddleware(t time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return withContextTimeout(c, t, c.Next)
+	}
+}
+
+func withContextTimeout(c *fiber.Ctx, t time.Duration, next func() error) error {
+	timeoutContext, cancel := context.WithTimeout(c.UserContext(), t)
+	defer cancel()
+	c.SetUserContext(timeoutContext)
+	err := next()
+	if err != nil {
+		if es.Is(err, context.DeadlineExceeded) {
+			return fiber.ErrRequestTimeout
 		}
-		return err
 	}
+	return err
+}
+
+// PanicError 在其它协程中恢复后重新抛出的 panic,Stack 为原协程的调用栈,
+// RecoveryMiddleware 恢复该类型的 panic 时使用 Value 和 Stack
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap 在 Value 为 error 时返回该错误
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// unwrapPanic 返回 panic 的原始值和调用栈,r 不是 *PanicError 时调用栈为 stack
+func unwrapPanic(r interface{}, stack []byte) (interface{}, []byte) {
+	if p, ok := r.(*PanicError); ok {
+		return p.Value, p.Stack
+	}
+	return r, stack
+}
+
+func recoverPanic(c *fiber.Ctx, config *RecoveryConfig, next func() error) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		r, stack := unwrapPanic(r, debug.Stack())
+		// 没有开启链路追踪时为空操作的 span
+		span := trace.SpanFromContext(c.UserContext())
+		span.RecordError(fmt.Errorf("panic: %v", r), trace.WithAttributes(semconv.ExceptionStacktrace(string(stack))))
+		span.SetStatus(codes.Error, fmt.Sprintf("panic: %v", r))
+		err = sendPanic(c, r)
+		if config.PanicHook != nil {
+			runPanicHook(c, config.PanicHook, r, stack)
+		}
+		fields := []zap.Field{zap.String("method", c.Method()), zap.String("path", c.Path()), zap.String("request_id", httpxcommons.GetRequestID(c))}
+		if !config.DisableStackTrace {
+			fields = append(fields, zap.ByteString("stack", stack))
+		}
+		logger := newLevelLogger(config.Logger)
+		if errStr, ok := r.(string); ok {
+			logger.dpanic(errStr, fields...)
+			return
+		}
+		e := errors.ConverUnknowError(r)
+		if errors.IsMessageError(e) || strings.HasPrefix(e.Error(), "context ") || strings.HasPrefix(e.Error(), "rpc error") {
+			logger.error(e.Error(), fields...)
+		} else {
+			logger.dpanic(e.Error(), fields...)
+		}
+	}()
+	return next()
+}
+
+// sendPanic 丢弃处理器已经写入的响应体,输出500错误,只有 MessageError 会把错误信息返回给客户端
+func sendPanic(c *fiber.Ctx, r interface{}) error {
+	c.Response().ResetBody()
+	if err, ok := r.(error); ok && errors.IsMessageError(err) {
+		return httpxcommons.SendErrors(c, err, fiber.StatusInternalServerError, fiber.StatusInternalServerError)
+	}
+	return httpxcommons.SendError(c, "系统内部错误", fiber.StatusInternalServerError, fiber.StatusInternalServerError)
+}
+
+func runPanicHook(c *fiber.Ctx, hook PanicHook, r interface{}, stack []byte) {
+	defer func() {
+		if e := recover(); e != nil {
+			log.Error("执行PanicHook失败", zap.Any("error", e))
+		}
+	}()
+	hook(c, r, stack)
 }
@@ -0,0 +1,135 @@
+package httpx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	es "errors"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func partialThenPanic(c *fiber.Ctx) error {
+	c.WriteString("partial")
+	panic(c.Query("value", "boom"))
+}
+
+// newRecoveryApp 返回使用 config 恢复 panic 的应用和捕获到的日志
+func newRecoveryApp(config RecoveryConfig) (*fiber.App, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	config.Logger = zap.New(core)
+	app := fiber.New()
+	app.Use(RequestIDMiddleware(""))
+	app.Use(RecoveryMiddleware(config))
+	app.Get("/panic", partialThenPanic)
+	app.Get("/error", func(c *fiber.Ctx) error {
+		panic(es.New("db: password=secret"))
+	})
+	app.Get("/canceled", func(c *fiber.Ctx) error {
+		panic(context.Canceled)
+	})
+	return app, logs
+}
+
+func recoveryRequest(t *testing.T, app *fiber.App, target, accept string) (int, []byte) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodGet, target, nil)
+	req.Header.Set(fiber.HeaderAccept, accept)
+	req.Header.Set(fiber.HeaderXRequestID, "req-1")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestRecoveryResponse(t *testing.T) {
+	app, _ := newRecoveryApp(RecoveryConfig{})
+	for _, target := range []string{"/panic", "/panic?value=db:+password=secret", "/error"} {
+		status, body := recoveryRequest(t, app, target, fiber.MIMEApplicationJSON)
+		resp := &httpxcommons.AjaxResponse{}
+		if err := json.Unmarshal(body, resp); err != nil {
+			t.Fatalf("%s: 已写入的响应体应被丢弃, got %s", target, body)
+		}
+		if status != fiber.StatusInternalServerError || resp.Code != fiber.StatusInternalServerError || resp.Success ||
+			resp.Message != "系统内部错误" || resp.RequestID != "req-1" {
+			t.Fatalf("%s: status=%d resp=%+v", target, status, resp)
+		}
+
+		status, body = recoveryRequest(t, app, target, "application/x-protobuf")
+		pb := &httpxcommons.PBResponse{}
+		if err := proto.Unmarshal(body, pb); err != nil || bytes.Contains(body, []byte("partial")) {
+			t.Fatalf("%s: got %q err=%v", target, body, err)
+		}
+		if status != fiber.StatusInternalServerError || pb.Code != fiber.StatusInternalServerError || pb.Message != "系统内部错误" || pb.RequestId != "req-1" {
+			t.Fatalf("%s: status=%d resp=%v", target, status, pb)
+		}
+	}
+}
+
+func TestRecoveryPanicHook(t *testing.T) {
+	var recovered interface{}
+	var stack []byte
+	var requestID string
+	app, _ := newRecoveryApp(RecoveryConfig{PanicHook: func(c *fiber.Ctx, r interface{}, s []byte) {
+		recovered, stack, requestID = r, s, httpxcommons.GetRequestID(c)
+	}})
+	if status, _ := recoveryRequest(t, app, "/panic", fiber.MIMEApplicationJSON); status != fiber.StatusInternalServerError {
+		t.Fatalf("status=%d", status)
+	}
+	if recovered != "boom" || requestID != "req-1" || !bytes.Contains(stack, []byte("partialThenPanic")) {
+		t.Fatalf("recovered=%#v request_id=%q stack:\n%s", recovered, requestID, stack)
+	}
+
+	// PanicHook 自身 panic 时不影响响应
+	app, _ = newRecoveryApp(RecoveryConfig{PanicHook: func(*fiber.Ctx, interface{}, []byte) {
+		panic("hook")
+	}})
+	if status, body := recoveryRequest(t, app, "/panic", fiber.MIMEApplicationJSON); status != fiber.StatusInternalServerError || !strings.Contains(string(body), "系统内部错误") {
+		t.Fatalf("status=%d body=%s", status, body)
+	}
+}
+
+func TestRecoveryLog(t *testing.T) {
+	cases := []struct {
+		target string
+		level  zapcore.Level
+	}{
+		{"/panic", zapcore.DPanicLevel},
+		{"/error", zapcore.DPanicLevel},
+		{"/canceled", zapcore.ErrorLevel},
+	}
+	for _, disableStackTrace := range []bool{false, true} {
+		app, logs := newRecoveryApp(RecoveryConfig{DisableStackTrace: disableStackTrace})
+		for _, tc := range cases {
+			recoveryRequest(t, app, tc.target, fiber.MIMEApplicationJSON)
+			entries := logs.TakeAll()
+			if len(entries) != 1 {
+				t.Fatalf("%s: got %d", tc.target, len(entries))
+			}
+			fields := entries[0].ContextMap()
+			if entries[0].Level != tc.level || fields["request_id"] != "req-1" || fields["path"] != tc.target {
+				t.Fatalf("%s: level=%s fields=%v", tc.target, entries[0].Level, fields)
+			}
+			stack, ok := fields["stack"].(string)
+			if disableStackTrace && ok {
+				t.Fatalf("%s: DisableStackTrace 时不应输出调用栈", tc.target)
+			}
+			if !disableStackTrace && !strings.Contains(stack, "goroutine") {
+				t.Fatalf("%s: 应输出调用栈, got %v", tc.target, fields["stack"])
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package httpx
+
+import (
+	"crypto/x509"
+	"github.com/gofiber/fiber/v2"
+	"strings"
+)
+
+type peerIdentityKey struct{}
+
+// PeerIdentity 是mTLS校验通过的客户端身份
+type PeerIdentity struct {
+	Subject        string
+	CommonName     string
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []string
+	URIs           []string
+	// SPIFFEID 是证书 URI SAN 中 spiffe:// 开头的身份标识
+	SPIFFEID    string
+	Certificate *x509.Certificate
+}
+
+func newPeerIdentity(cert *x509.Certificate) *PeerIdentity {
+	identity := &PeerIdentity{
+		Subject:        cert.Subject.String(),
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		Certificate:    cert,
+	}
+	for _, ip := range cert.IPAddresses {
+		identity.IPAddresses = append(identity.IPAddresses, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		u := uri.String()
+		identity.URIs = append(identity.URIs, u)
+		if identity.SPIFFEID == "" && strings.EqualFold(uri.Scheme, "spiffe") {
+			identity.SPIFFEID = u
+		}
+	}
+	return identity
+}
+
+// GetPeerIdentity 获取当前请求经过校验的客户端证书身份,非mTLS请求返回 nil,
+// 结果会缓存在 fiber.Ctx 的 Locals 中
+func GetPeerIdentity(c *fiber.Ctx) *PeerIdentity {
+	if identity, ok := c.Locals(peerIdentityKey{}).(*PeerIdentity); ok {
+		return identity
+	}
+	state := c.Context().TLSConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	identity := newPeerIdentity(state.VerifiedChains[0][0])
+	c.Locals(peerIdentityKey{}, identity)
+	return identity
+}
@@ -2,6 +2,7 @@ package httpx
 
 import (
 	"net"
+	"sync"
 	"time"
 )
 
@@ -29,3 +30,67 @@ func Listen(addr string) (net.Listener, error) {
 	}
 	return tcpKeepAliveListener{ln.(*net.TCPListener)}, nil
 }
+
+// connTracker 记录当前由服务端持有的连接,用于优雅关闭超时后强制关闭残留连接
+type connTracker struct {
+	mutex sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{conns: make(map[net.Conn]struct{})}
+}
+
+func (t *connTracker) add(c net.Conn) {
+	t.mutex.Lock()
+	t.conns[c] = struct{}{}
+	t.mutex.Unlock()
+}
+
+func (t *connTracker) remove(c net.Conn) {
+	t.mutex.Lock()
+	delete(t.conns, c)
+	t.mutex.Unlock()
+}
+
+// closeAll 强制关闭所有残留连接,返回关闭的连接数
+func (t *connTracker) closeAll() int {
+	t.mutex.Lock()
+	conns := make([]net.Conn, 0, len(t.conns))
+	for c := range t.conns {
+		conns = append(conns, c)
+	}
+	t.mutex.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+	return len(conns)
+}
+
+type trackedListener struct {
+	net.Listener
+	tracker *connTracker
+}
+
+func (ln trackedListener) Accept() (net.Conn, error) {
+	c, err := ln.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	tc := &trackedConn{Conn: c, tracker: ln.tracker}
+	ln.tracker.add(tc)
+	return tc, nil
+}
+
+type trackedConn struct {
+	net.Conn
+	tracker *connTracker
+	once    sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		c.tracker.remove(c)
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,240 @@
+package httpx
+
+import (
+	"encoding"
+	"fmt"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"github.com/gofiber/fiber/v2"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 参数来源对应的结构体标签,时间格式通过 time_format 标签指定,默认为 RFC3339,
+// 也可以使用 unix、unixmilli 表示时间戳
+const (
+	TagParam  = "param"
+	TagQuery  = "query"
+	TagHeader = "header"
+	TagCookie = "cookie"
+	// TagForm 表单绑定使用的标签,BindingForm 同时从 URL 参数中读取该标签的字段
+	TagForm = "form"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// BindParams 将路由参数(param 标签)解析到 obj
+func BindParams(c *fiber.Ctx, obj interface{}) error {
+	return bindValues(obj, TagParam, paramValues(c))
+}
+
+// BindQuery 将 URL 参数(query 标签)解析到 obj,支持 Duration、时间和重复参数组成的切片
+func BindQuery(c *fiber.Ctx, obj interface{}) error {
+	return bindValues(obj, TagQuery, queryValues(c))
+}
+
+// BindHeader 将请求头(header 标签)解析到 obj
+func BindHeader(c *fiber.Ctx, obj interface{}) error {
+	return bindValues(obj, TagHeader, headerValues(c))
+}
+
+// BindCookie 将 Cookie(cookie 标签)解析到 obj
+func BindCookie(c *fiber.Ctx, obj interface{}) error {
+	return bindValues(obj, TagCookie, cookieValues(c))
+}
+
+// BindAll 合并请求体、Cookie、请求头、URL参数和路由参数到同一个结构体后校验,
+// 同一字段存在多个来源时优先级为 路由参数 > URL参数 > 请求头 > Cookie > 请求体
+func BindAll(c *fiber.Ctx, obj interface{}) error {
+	if c.Method() != fiber.MethodGet && len(c.Body()) > 0 {
+		if err := GetBinding(c).Bind(c, obj); err != nil {
+			return err
+		}
+	}
+	for _, bind := range []func(*fiber.Ctx, interface{}) error{BindCookie, BindHeader, BindQuery, BindParams} {
+		if err := bind(c, obj); err != nil {
+			return err
+		}
+	}
+	return validate(obj)
+}
+
+func paramValues(c *fiber.Ctx) func(key string) []string {
+	return func(key string) []string {
+		if v := c.Params(key); v != "" {
+			return []string{v}
+		}
+		return nil
+	}
+}
+
+func queryValues(c *fiber.Ctx) func(key string) []string {
+	return func(key string) []string {
+		return byteValues(c.Context().QueryArgs().PeekMulti(key))
+	}
+}
+
+func headerValues(c *fiber.Ctx) func(key string) []string {
+	return func(key string) []string {
+		return byteValues(c.Request().Header.PeekAll(key))
+	}
+}
+
+func cookieValues(c *fiber.Ctx) func(key string) []string {
+	return func(key string) []string {
+		if v := c.Cookies(key); v != "" {
+			return []string{v}
+		}
+		return nil
+	}
+}
+
+func byteValues(raw [][]byte) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	values := make([]string, 0, len(raw))
+	for _, v := range raw {
+		values = append(values, string(v))
+	}
+	return values
+}
+
+func bindValues(obj interface{}, tag string, lookup func(key string) []string) error {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("httpx: %s binding requires a non-nil pointer to struct", tag)
+	}
+	errs := bindStruct(v.Elem(), tag, lookup, nil)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func bindStruct(v reflect.Value, tag string, lookup func(key string) []string, errs httpxcommons.ValidationErrors) httpxcommons.ValidationErrors {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				errs = bindStruct(fv, tag, lookup, errs)
+			}
+			continue
+		}
+		values := lookup(key)
+		if len(values) == 0 {
+			continue
+		}
+		if err := setField(fv, values, field.Tag.Get("time_format")); err != nil {
+			errs = append(errs, &httpxcommons.FieldError{Field: key, Rule: "type", Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+func setField(v reflect.Value, values []string, timeFormat string) error {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		if len(values) == 1 {
+			values = strings.Split(values[0], ",")
+		}
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(slice.Index(i), strings.TrimSpace(value), timeFormat); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+	return setValue(v, values[0], timeFormat)
+}
+
+func setValue(v reflect.Value, value string, timeFormat string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setValue(v.Elem(), value, timeFormat)
+	}
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("无法解析时长%q", value)
+		}
+		v.SetInt(int64(d))
+		return nil
+	case v.Type() == timeType:
+		t, err := parseTime(value, timeFormat)
+		if err != nil {
+			return fmt.Errorf("无法解析时间%q", value)
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case reflect.PtrTo(v.Type()).Implements(textUnmarshalerType):
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("无法解析布尔值%q", value)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("无法解析整数%q", value)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("无法解析整数%q", value)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("无法解析数字%q", value)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("不支持的字段类型%s", v.Type())
+	}
+	return nil
+}
+
+func parseTime(value string, layout string) (time.Time, error) {
+	switch layout {
+	case "", "RFC3339":
+		return time.Parse(time.RFC3339, value)
+	case "unix", "unixmilli":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if layout == "unix" {
+			return time.Unix(n, 0), nil
+		}
+		return time.UnixMilli(n), nil
+	default:
+		return time.ParseInLocation(layout, value, time.Local)
+	}
+}
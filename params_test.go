@@ -0,0 +1,176 @@
+package httpx
+
+import (
+	es "errors"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"github.com/gofiber/fiber/v2"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// upperText 实现 encoding.TextUnmarshaler,只接受字母
+type upperText string
+
+func (u *upperText) UnmarshalText(text []byte) error {
+	for _, b := range text {
+		if (b < 'a' || b > 'z') && (b < 'A' || b > 'Z') {
+			return es.New("只能包含字母")
+		}
+	}
+	*u = upperText(strings.ToUpper(string(text)))
+	return nil
+}
+
+type queryTarget struct {
+	Timeout time.Duration `query:"timeout"`
+	At      time.Time     `query:"at"`
+	Day     time.Time     `query:"day" time_format:"2006-01-02"`
+	Unix    time.Time     `query:"unix" time_format:"unix"`
+	Milli   time.Time     `query:"milli" time_format:"unixmilli"`
+	IDs     []int         `query:"ids"`
+	Tags    []string      `query:"tag"`
+	Limit   *int          `query:"limit"`
+	Level   upperText     `query:"level"`
+	Levels  []*upperText  `query:"levels"`
+	Ignored string        `query:"-"`
+}
+
+func bindQueryString(t *testing.T, query string) (*queryTarget, error) {
+	t.Helper()
+	app := fiber.New()
+	obj := &queryTarget{}
+	var bindErr error
+	app.Get("/", func(c *fiber.Ctx) error {
+		bindErr = BindQuery(c, obj)
+		return nil
+	})
+	if _, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/?"+query, nil)); err != nil {
+		t.Fatal(err)
+	}
+	return obj, bindErr
+}
+
+func TestBindQueryTypes(t *testing.T) {
+	limit := 5
+	word := upperText("B")
+	cases := []struct {
+		query string
+		want  queryTarget
+	}{
+		{"timeout=1m30s", queryTarget{Timeout: 90 * time.Second}},
+		{"at=2024-01-02T03:04:05Z", queryTarget{At: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}},
+		{"day=2024-01-02", queryTarget{Day: time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)}},
+		{"unix=1700000000", queryTarget{Unix: time.Unix(1700000000, 0)}},
+		{"milli=1700000000123", queryTarget{Milli: time.UnixMilli(1700000000123)}},
+		{"ids=1,2,3", queryTarget{IDs: []int{1, 2, 3}}},
+		{"ids=1&ids=2", queryTarget{IDs: []int{1, 2}}},
+		{"tag=a&tag=b", queryTarget{Tags: []string{"a", "b"}}},
+		{"limit=5", queryTarget{Limit: &limit}},
+		{"level=warn", queryTarget{Level: "WARN"}},
+		{"levels=b", queryTarget{Levels: []*upperText{&word}}},
+		{"Ignored=x", queryTarget{}},
+	}
+	for _, tc := range cases {
+		got, err := bindQueryString(t, tc.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.query, err)
+		}
+		if !reflect.DeepEqual(*got, tc.want) {
+			t.Fatalf("%s: got %+v, want %+v", tc.query, *got, tc.want)
+		}
+	}
+}
+
+func TestBindQueryErrors(t *testing.T) {
+	cases := map[string]string{
+		"timeout=10":      "timeout",
+		"at=2024-01-02":   "at",
+		"day=2024/01/02":  "day",
+		"unix=now":        "unix",
+		"milli=1.5":       "milli",
+		"ids=1,x":         "ids",
+		"limit=-":         "limit",
+		"level=w1":        "level",
+		"limit=1&ids=a,b": "ids",
+	}
+	for query, field := range cases {
+		_, err := bindQueryString(t, query)
+		var fieldErrors httpxcommons.ValidationErrors
+		if !es.As(err, &fieldErrors) || len(fieldErrors) != 1 || fieldErrors[0].Field != field || fieldErrors[0].Rule != "type" {
+			t.Fatalf("%s: 应返回 %s 字段的类型错误, got %v", query, field, err)
+		}
+	}
+	// 多个字段出错时全部返回
+	_, err := bindQueryString(t, "timeout=x&unix=y")
+	var fieldErrors httpxcommons.ValidationErrors
+	if !es.As(err, &fieldErrors) || len(fieldErrors) != 2 {
+		t.Fatalf("got %v", err)
+	}
+}
+
+type precedenceTarget struct {
+	Value string `param:"value" query:"value" header:"X-Value" cookie:"value" json:"value"`
+}
+
+func TestBindAllPrecedence(t *testing.T) {
+	cases := []struct {
+		name   string
+		target string
+		header bool
+		cookie bool
+		body   bool
+		want   string
+	}{
+		{"路由参数", "/with/param?value=query", true, true, true, "param"},
+		{"URL参数", "/without?value=query", true, true, true, "query"},
+		{"请求头", "/without", true, true, true, "header"},
+		{"Cookie", "/without", false, true, true, "cookie"},
+		{"请求体", "/without", false, false, true, "body"},
+	}
+	app := fiber.New()
+	var got string
+	handler := func(c *fiber.Ctx) error {
+		obj := &precedenceTarget{}
+		if err := BindAll(c, obj); err != nil {
+			return err
+		}
+		got = obj.Value
+		return nil
+	}
+	app.Post("/with/:value", handler)
+	app.Post("/without", handler)
+	for _, tc := range cases {
+		body := ""
+		if tc.body {
+			body = `{"value":"body"}`
+		}
+		req := httptest.NewRequest(fiber.MethodPost, tc.target, strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		if tc.header {
+			req.Header.Set("X-Value", "header")
+		}
+		if tc.cookie {
+			req.Header.Set(fiber.HeaderCookie, "value=cookie")
+		}
+		got = ""
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusOK || got != tc.want {
+			t.Fatalf("%s: status=%d got %q, want %q", tc.name, resp.StatusCode, got, tc.want)
+		}
+	}
+}
+
+func TestBindValuesRequiresStructPointer(t *testing.T) {
+	var target queryTarget
+	for _, obj := range []interface{}{target, (*queryTarget)(nil), new(int)} {
+		if err := bindValues(obj, TagQuery, func(string) []string { return nil }); err == nil {
+			t.Fatalf("%T 应返回错误", obj)
+		}
+	}
+}
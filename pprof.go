@@ -1,88 +1,94 @@
 package httpx
 
-//import (
-//	"github.com/gofiber/fiber/v2"
-//	"net/http/pprof"
-//)
-//
-//func RegisterPprof(route fiber.Router) {
-//	route = route.Group("/debug/pprof")
-//	route.Get("/", indexHandler())
-//	route.Get("/heap", heapHandler())
-//	route.Get("/goroutine", goroutineHandler())
-//	route.Get("/block", blockHandler())
-//	route.Get("/threadcreate", threadCreateHandler())
-//	route.Get("/cmdline", cmdlineHandler())
-//	route.Get("/profile", profileHandler())
-//	route.Get("/symbol", symbolHandler())
-//	route.Get("/symbol", symbolHandler())
-//	route.Get("/trace", traceHandler())
-//	route.Get("/mutex", mutexHandler())
-//	route.Get("/allocs", allocsHandler())
-//
-//}
-//
-//// IndexHandler will pass the call from /debug/pprof to pprof
-//func indexHandler() fiber.Handler {
-//	return func(ctx *fiber.Ctx) error {
-//		pprof.Index(ctx.Writer, ctx.Request)
-//	}
-//}
-//
-//// HeapHandler will pass the call from /debug/pprof/heap to pprof
-//func heapHandler() fiber.Handler {
-//	return gin.WrapH(pprof.Handler("heap"))
-//}
-//
-//// GoroutineHandler will pass the call from /debug/pprof/goroutine to pprof
-//func allocsHandler() fiber.Handler {
-//	return gin.WrapH(pprof.Handler("allocs"))
-//}
-//
-//// GoroutineHandler will pass the call from /debug/pprof/goroutine to pprof
-//func goroutineHandler() fiber.Handler {
-//	return gin.WrapH(pprof.Handler("goroutine"))
-//}
-//
-//// BlockHandler will pass the call from /debug/pprof/block to pprof
-//func blockHandler() fiber.Handler {
-//	return gin.WrapH(pprof.Handler("block"))
-//}
-//
-//// ThreadCreateHandler will pass the call from /debug/pprof/threadcreate to pprof
-//func threadCreateHandler() fiber.Handler {
-//	return gin.WrapH(pprof.Handler("threadcreate"))
-//}
-//
-//// CmdlineHandler will pass the call from /debug/pprof/cmdline to pprof
-//func cmdlineHandler() fiber.Handler {
-//	return func(ctx *gin.Context) {
-//		pprof.Cmdline(ctx.Writer, ctx.Request)
-//	}
-//}
-//
-//// ProfileHandler will pass the call from /debug/pprof/profile to pprof
-//func profileHandler() fiber.Handler {
-//	return func(ctx *gin.Context) {
-//		pprof.Profile(ctx.Writer, ctx.Request)
-//	}
-//}
-//
-//// SymbolHandler will pass the call from /debug/pprof/symbol to pprof
-//func symbolHandler() fiber.Handler {
-//	return func(ctx *gin.Context) {
-//		pprof.Symbol(ctx.Writer, ctx.Request)
-//	}
-//}
-//
-//// TraceHandler will pass the call from /debug/pprof/trace to pprof
-//func traceHandler() fiber.Handler {
-//	return func(ctx *gin.Context) {
-//		pprof.Trace(ctx.Writer, ctx.Request)
-//	}
-//}
-//
-//// MutexHandler will pass the call from /debug/pprof/mutex to pprof
-//func mutexHandler() fiber.Handler {
-//	return gin.WrapH(pprof.Handler("mutex"))
-//}
+import (
+	"crypto/subtle"
+	"github.com/coffeehc/base/errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"net"
+	"net/http/pprof"
+	"strings"
+)
+
+// PprofConfig pprof 接口配置,Token 和 AllowIPs 都为空时不做访问控制
+type PprofConfig struct {
+	Enable bool `mapstructure:"enable,omitempty" json:"enable,omitempty"`
+	// Prefix 挂载路径,默认为 /debug/pprof
+	Prefix string `mapstructure:"prefix,omitempty" json:"prefix,omitempty"`
+	// Token 访问令牌,通过 Authorization: Bearer <token> 请求头传入,不支持URL参数以免令牌出现在访问日志中
+	Token string `mapstructure:"token,omitempty" json:"token,omitempty"`
+	// AllowIPs 允许访问的IP或网段(CIDR),为空时不限制。按连接的对端地址判断,不信任 ProxyHeader 等客户端可以伪造的请求头
+	AllowIPs []string `mapstructure:"allow_ips,omitempty" json:"allow_ips,omitempty"`
+}
+
+func (impl *PprofConfig) getPrefix() string {
+	if impl.Prefix == "" {
+		impl.Prefix = "/debug/pprof"
+	}
+	return impl.Prefix
+}
+
+// RegisterPprof 在 router 上挂载 net/http/pprof 的接口,opts 为空或未开启时不挂载
+func RegisterPprof(router fiber.Router, opts *PprofConfig) error {
+	if opts == nil || !opts.Enable {
+		return nil
+	}
+	guard, err := pprofGuard(opts)
+	if err != nil {
+		return err
+	}
+	route := router.Group(opts.getPrefix(), guard)
+	route.Get("/", adaptor.HTTPHandlerFunc(pprof.Index))
+	for _, name := range []string{"heap", "goroutine", "block", "mutex", "allocs", "threadcreate"} {
+		route.Get("/"+name, adaptor.HTTPHandler(pprof.Handler(name)))
+	}
+	route.Get("/cmdline", adaptor.HTTPHandlerFunc(pprof.Cmdline))
+	route.Get("/profile", adaptor.HTTPHandlerFunc(pprof.Profile))
+	route.Get("/symbol", adaptor.HTTPHandlerFunc(pprof.Symbol))
+	route.Post("/symbol", adaptor.HTTPHandlerFunc(pprof.Symbol))
+	route.Get("/trace", adaptor.HTTPHandlerFunc(pprof.Trace))
+	return nil
+}
+
+func pprofGuard(opts *PprofConfig) (fiber.Handler, error) {
+	nets := make([]*net.IPNet, 0, len(opts.AllowIPs))
+	for _, allow := range opts.AllowIPs {
+		if !strings.Contains(allow, "/") {
+			if ip := net.ParseIP(allow); ip != nil && ip.To4() != nil {
+				allow += "/32"
+			} else {
+				allow += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(allow)
+		if err != nil {
+			return nil, errors.SystemError("pprof允许访问的IP配置错误:" + allow)
+		}
+		nets = append(nets, ipNet)
+	}
+	token := []byte(opts.Token)
+	return func(c *fiber.Ctx) error {
+		if len(nets) > 0 && !ipAllowed(c.Context().RemoteIP(), nets) {
+			return fiber.ErrForbidden
+		}
+		if len(token) > 0 {
+			provided := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(provided), token) != 1 {
+				return fiber.ErrUnauthorized
+			}
+		}
+		return c.Next()
+	}, nil
+}
+
+func ipAllowed(ip net.IP, nets []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package httpx
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"net/http/httptest"
+	"testing"
+)
+
+func pprofStatus(t *testing.T, opts *PprofConfig, target string, headers map[string]string) int {
+	t.Helper()
+	app := fiber.New(fiber.Config{ProxyHeader: fiber.HeaderXForwardedFor})
+	if err := RegisterPprof(app, opts); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(fiber.MethodGet, target, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+// app.Test 使用的连接对端地址为 0.0.0.0
+func TestPprofAllowIPs(t *testing.T) {
+	opts := &PprofConfig{Enable: true, AllowIPs: []string{"10.0.0.0/8"}}
+	spoofed := map[string]string{fiber.HeaderXForwardedFor: "10.0.0.1"}
+	if status := pprofStatus(t, opts, "/debug/pprof/cmdline", spoofed); status != fiber.StatusForbidden {
+		t.Fatalf("伪造 X-Forwarded-For 不应绕过IP限制, status=%d", status)
+	}
+	opts = &PprofConfig{Enable: true, AllowIPs: []string{"0.0.0.0"}}
+	if status := pprofStatus(t, opts, "/debug/pprof/cmdline", nil); status != fiber.StatusOK {
+		t.Fatalf("允许的地址应能访问, status=%d", status)
+	}
+}
+
+func TestPprofToken(t *testing.T) {
+	opts := &PprofConfig{Enable: true, Token: "secret"}
+	if status := pprofStatus(t, opts, "/debug/pprof/cmdline", nil); status != fiber.StatusUnauthorized {
+		t.Fatalf("没有令牌时应返回401, status=%d", status)
+	}
+	if status := pprofStatus(t, opts, "/debug/pprof/cmdline?token=secret", nil); status != fiber.StatusUnauthorized {
+		t.Fatalf("不应接受URL参数中的令牌, status=%d", status)
+	}
+	bearer := map[string]string{fiber.HeaderAuthorization: "Bearer secret"}
+	if status := pprofStatus(t, opts, "/debug/pprof/cmdline", bearer); status != fiber.StatusOK {
+		t.Fatalf("正确的令牌应能访问, status=%d", status)
+	}
+}
+
+func TestPprofDisabled(t *testing.T) {
+	if status := pprofStatus(t, &PprofConfig{}, "/debug/pprof/cmdline", nil); status != fiber.StatusNotFound {
+		t.Fatalf("未开启时不应挂载, status=%d", status)
+	}
+}
@@ -0,0 +1,51 @@
+package httpx
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"github.com/gofiber/fiber/v2"
+	"strings"
+)
+
+// DefaultRequestIDHeader 默认的请求ID请求头
+const DefaultRequestIDHeader = fiber.HeaderXRequestID
+
+// RequestIDMiddleware 从 header 请求头读取请求ID,没有或不合法时生成新的ID,
+// 保存到 Locals 和 UserContext 中并通过同名响应头返回,header 为空时使用 X-Request-ID
+func RequestIDMiddleware(header string) fiber.Handler {
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+	return func(c *fiber.Ctx) error {
+		requestID := c.Get(header)
+		if validRequestID(requestID) {
+			// c.Get 返回的字符串在请求结束后会被复用
+			requestID = strings.Clone(requestID)
+		} else {
+			requestID = newRequestID()
+		}
+		httpxcommons.SetRequestID(c, requestID)
+		c.Set(header, requestID)
+		return c.Next()
+	}
+}
+
+// validRequestID 只接受长度不超过128的可见ASCII字符,避免日志注入
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > 128 {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] < 0x21 || requestID[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
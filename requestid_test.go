@@ -0,0 +1,94 @@
+package httpx
+
+import (
+	"encoding/hex"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"github.com/gofiber/fiber/v2"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newRequestIDApp 返回的应用在响应体中输出 Locals 和 UserContext 中的请求ID,seen 记录每次请求保存的ID
+func newRequestIDApp(header string, seen *[]string) *fiber.App {
+	app := fiber.New()
+	app.Use(RequestIDMiddleware(header))
+	app.Get("/", func(c *fiber.Ctx) error {
+		requestID := httpxcommons.GetRequestID(c)
+		*seen = append(*seen, requestID)
+		return c.SendString(requestID + "|" + httpxcommons.RequestIDFromContext(c.UserContext()))
+	})
+	return app
+}
+
+func requestWithID(t *testing.T, app *fiber.App, header, requestID string) (string, string) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+	if requestID != "" {
+		req.Header.Set(header, requestID)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, fromContext, _ := strings.Cut(string(body), "|")
+	if local != fromContext {
+		t.Fatalf("Locals 与 UserContext 中的请求ID不一致: %q %q", local, fromContext)
+	}
+	if echoed := resp.Header.Get(header); echoed != local {
+		t.Fatalf("响应头应返回请求ID, got %q want %q", echoed, local)
+	}
+	return local, fromContext
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	for _, header := range []string{"", "X-Trace-ID"} {
+		var seen []string
+		app := newRequestIDApp(header, &seen)
+		if header == "" {
+			header = DefaultRequestIDHeader
+		}
+		if got, _ := requestWithID(t, app, header, "req-123_abc"); got != "req-123_abc" {
+			t.Fatalf("%s: 合法的请求ID应保留, got %q", header, got)
+		}
+		generated := make(map[string]bool)
+		for _, requestID := range []string{"", "a b", "请求", strings.Repeat("a", 129)} {
+			got, _ := requestWithID(t, app, header, requestID)
+			if _, err := hex.DecodeString(got); err != nil || len(got) != 32 || got == requestID {
+				t.Fatalf("%s: 请求ID %q 不合法时应生成新的ID, got %q", header, requestID, got)
+			}
+			if generated[got] {
+				t.Fatalf("%s: 生成了重复的请求ID %q", header, got)
+			}
+			generated[got] = true
+		}
+		// 保存的请求ID不应引用 fasthttp 复用的请求头缓冲区
+		if seen[0] != "req-123_abc" {
+			t.Fatalf("%s: 请求结束后保存的请求ID被修改为 %q", header, seen[0])
+		}
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	cases := map[string]bool{
+		"":                       false,
+		"abc":                    true,
+		"!~":                     true,
+		strings.Repeat("a", 128): true,
+		strings.Repeat("a", 129): false,
+		"a b":                    false,
+		"a\tb":                   false,
+		"a\x7f":                  false,
+		"é":                      false,
+	}
+	for requestID, want := range cases {
+		if got := validRequestID(requestID); got != want {
+			t.Fatalf("validRequestID(%q)=%v", requestID, got)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package httpx
+
+import (
+	"context"
+	es "errors"
+	"fmt"
+	"github.com/coffeehc/base/errors"
+	"github.com/coffeehc/base/log"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ExitReason 描述 Run 退出的原因
+type ExitReason int
+
+const (
+	// ExitReasonServerStopped 服务自行停止,通常是监听失败或被其他地方调用了 Shutdown
+	ExitReasonServerStopped ExitReason = iota
+	// ExitReasonSignal 收到 SIGINT/SIGTERM 信号后优雅关闭
+	ExitReasonSignal
+	// ExitReasonContextDone 传入的 context 结束后优雅关闭
+	ExitReasonContextDone
+)
+
+// Error 使 ExitReason 可以作为 errors.Is 的目标,如 errors.Is(err, httpx.ExitReasonSignal)
+func (r ExitReason) Error() string {
+	return "httpx: exit by " + r.String()
+}
+
+func (r ExitReason) String() string {
+	switch r {
+	case ExitReasonServerStopped:
+		return "server stopped"
+	case ExitReasonSignal:
+		return "signal"
+	case ExitReasonContextDone:
+		return "context done"
+	default:
+		return fmt.Sprintf("ExitReason(%d)", int(r))
+	}
+}
+
+// ExitError 是 Run 的返回值,Reason 为退出的原因,Err 为服务或关闭过程中的错误,正常退出时为空
+type ExitError struct {
+	Reason ExitReason
+	Signal os.Signal
+	Err    error
+}
+
+func (e *ExitError) Error() string {
+	msg := "httpx: exit by " + e.Reason.String()
+	if e.Signal != nil {
+		msg += "(" + e.Signal.String() + ")"
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// Is 在 target 为相同的 ExitReason 时返回 true
+func (e *ExitError) Is(target error) bool {
+	reason, ok := target.(ExitReason)
+	return ok && reason == e.Reason
+}
+
+// Clean 是否为正常退出,即服务和关闭过程都没有错误
+func (e *ExitError) Clean() bool {
+	return e.Err == nil
+}
+
+// Run 启动服务并阻塞到服务结束,收到 SIGINT/SIGTERM 或 ctx 结束时触发优雅关闭,
+// 总是返回 *ExitError,通过 Reason 区分退出原因,Err 为空表示正常退出。
+// 收到第一个信号后恢复默认的信号处理,关闭过程中再次收到信号时进程直接退出
+func Run(ctx context.Context, service Service) error {
+	if service == nil {
+		return &ExitError{Reason: ExitReasonServerStopped, Err: errors.SystemError("service不能为空")}
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	errorSign := service.Start(nil)
+	exitErr := &ExitError{}
+	select {
+	case err := <-errorSign:
+		exitErr.Reason = ExitReasonServerStopped
+		if err != http.ErrServerClosed {
+			exitErr.Err = err
+		}
+		return exitErr
+	case sig := <-signals:
+		signal.Stop(signals)
+		exitErr.Reason = ExitReasonSignal
+		exitErr.Signal = sig
+		log.Info("收到退出信号,开始关闭HTTP服务", zap.String("signal", sig.String()))
+	case <-ctx.Done():
+		exitErr.Reason = ExitReasonContextDone
+		log.Info("context结束,开始关闭HTTP服务", zap.Error(ctx.Err()))
+	}
+	shutdownErr := service.ShutdownWithContext(context.Background())
+	serveErr := <-errorSign
+	if serveErr == http.ErrServerClosed {
+		serveErr = nil
+	}
+	exitErr.Err = es.Join(shutdownErr, serveErr)
+	if exitErr.Err == nil {
+		log.Info("HTTP服务已正常关闭", zap.String("reason", exitErr.Reason.String()))
+	}
+	return exitErr
+}
@@ -0,0 +1,190 @@
+package httpx
+
+import (
+	"bufio"
+	"context"
+	es "errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// newTestService 创建监听随机端口的服务,configure 用于修改默认的测试配置
+func newTestService(t *testing.T, configure ...func(config *Config)) Service {
+	t.Helper()
+	config := GetDefaultConfig("127.0.0.1:0", "test")
+	config.DisableStartupMessage = true
+	config.ShutdownDelayMs = -1
+	for _, fn := range configure {
+		fn(config)
+	}
+	service, err := NewServiceWithError(config)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	return service
+}
+
+// waitListening 等待服务开始监听
+func waitListening(t *testing.T, addr string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("服务没有在 %s 上监听", addr)
+}
+
+func runAsync(ctx context.Context, service Service) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, service)
+	}()
+	return done
+}
+
+func waitRun(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run 没有退出")
+		return nil
+	}
+}
+
+// assertCleanExit 检查 Run 以 reason 正常退出
+func assertCleanExit(t *testing.T, err error, reason ExitReason) {
+	t.Helper()
+	var exitErr *ExitError
+	if !es.As(err, &exitErr) || !exitErr.Clean() {
+		t.Fatalf("应正常退出, got %v", err)
+	}
+	if !es.Is(err, reason) {
+		t.Fatalf("退出原因应为 %s, got %s", reason, exitErr.Reason)
+	}
+}
+
+func TestRunContextDone(t *testing.T) {
+	service := newTestService(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := runAsync(ctx, service)
+	waitListening(t, service.GetServerAddress())
+	cancel()
+	assertCleanExit(t, waitRun(t, done), ExitReasonContextDone)
+}
+
+func TestRunSignal(t *testing.T) {
+	service := newTestService(t)
+	done := runAsync(context.Background(), service)
+	waitListening(t, service.GetServerAddress())
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	err := waitRun(t, done)
+	assertCleanExit(t, err, ExitReasonSignal)
+	if exitErr := err.(*ExitError); exitErr.Signal != syscall.SIGTERM {
+		t.Fatalf("signal=%v", exitErr.Signal)
+	}
+}
+
+// 其它地方调用 Shutdown 时以 ExitReasonServerStopped 正常退出
+func TestRunShutdownElsewhere(t *testing.T) {
+	service := newTestService(t)
+	done := runAsync(context.Background(), service)
+	waitListening(t, service.GetServerAddress())
+	if err := service.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	assertCleanExit(t, waitRun(t, done), ExitReasonServerStopped)
+}
+
+func TestRunNilService(t *testing.T) {
+	err := Run(context.Background(), nil)
+	var exitErr *ExitError
+	if !es.As(err, &exitErr) || exitErr.Clean() {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestRunServerStopped(t *testing.T) {
+	service := newTestService(t)
+	// 提前占用端口,使服务监听失败
+	l, err := net.Listen("tcp4", service.GetServerAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	err = waitRun(t, runAsync(context.Background(), service))
+	var exitErr *ExitError
+	if !es.As(err, &exitErr) {
+		t.Fatalf("监听失败时应返回 *ExitError, got %v", err)
+	}
+	if !es.Is(err, ExitReasonServerStopped) || exitErr.Clean() {
+		t.Fatalf("unexpected exit error: %+v", exitErr)
+	}
+}
+
+// 关闭过程中再次收到信号时进程直接退出,在子进程中运行 Run
+func TestRunSecondSignalExits(t *testing.T) {
+	if os.Getenv("HTTPX_RUN_CHILD") == "1" {
+		config := GetDefaultConfig("127.0.0.1:0", "test")
+		config.DisableStartupMessage = true
+		config.EnableHealthCheck = true
+		config.ShutdownDelayMs = 30000
+		service, err := NewServiceWithError(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Println(service.GetServerAddress())
+		Run(context.Background(), service)
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunSecondSignalExits$")
+	cmd.Env = append(os.Environ(), "HTTPX_RUN_CHILD=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	addr, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr = strings.TrimSpace(addr)
+	waitListening(t, addr)
+	cmd.Process.Signal(syscall.SIGTERM)
+	// /readyz 返回503说明 Run 已经处理了第一个信号并开始关闭
+	deadline := time.Now().Add(5 * time.Second)
+	for getStatus(t, "http://"+addr+"/readyz") != fiber.StatusServiceUnavailable {
+		if time.Now().After(deadline) {
+			t.Fatal("没有开始关闭")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	start := time.Now()
+	cmd.Process.Signal(syscall.SIGTERM)
+	err = cmd.Wait()
+	var exitErr *exec.ExitError
+	if !es.As(err, &exitErr) || exitErr.Sys().(syscall.WaitStatus).Signal() != syscall.SIGTERM {
+		t.Fatalf("子进程应被第二个信号终止, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("第二个信号后没有立即退出")
+	}
+}
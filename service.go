@@ -1,28 +1,68 @@
 package httpx
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	es "errors"
 	"fmt"
+	"github.com/coffeehc/base/errors"
 	"github.com/coffeehc/base/log"
+	"github.com/coffeehc/httpx/httpxcommons"
 	"github.com/gofiber/fiber/v2"
 	"go.uber.org/zap"
+	"io"
+	"net"
 	"net/http"
+	"sync"
+	"time"
 )
 
 type Service interface {
+	// Start 启动服务和运维端口,返回的 channel 在服务停止时写入一次错误,
+	// 运维端口启动失败或异常停止时主服务同样会停止并写入运维端口的错误
 	Start(onShutdown func()) <-chan error
 	StartWithCertificate(cert tls.Certificate, onShutdown func()) <-chan error
+	// StartWithCertificateSource 以 TLS 方式启动服务,握手时从 source 获取证书,可用于证书热加载
+	StartWithCertificateSource(source CertificateSource, onShutdown func()) <-chan error
 	Shutdown() error
+	// ShutdownWithContext 先使 /readyz 返回失败并等待 Config.ShutdownDelayMs,然后停止接收新连接,
+	// 在 Config.ShutdownTimeoutMs 内等待进行中的请求结束,超时后强制关闭残留连接,
+	// 最后按注册顺序执行 Start 时传入的 onShutdown 回调
+	ShutdownWithContext(ctx context.Context) error
 	GetEngine() *fiber.App
 	NewRouterGroup(prefix string) fiber.Router
 	GetServerAddress() string
+	// GetCertificateInfo 返回 StartWithCertificate 使用的证书信息,使用 StartWithCertificateSource 启动时为 source 的默认证书,
+	// source 为 CertificateReloader 时随重新加载更新,未使用证书启动时返回 nil
+	GetCertificateInfo() *httpxcommons.CertificateInfo
+	// GetAdminEngine 返回运维端口的 fiber 应用,未配置 Config.AdminAddr 时返回 nil
+	GetAdminEngine() *fiber.App
+	// GetHealthRegistry 返回健康检查注册表,用于注册组件的检查项
+	GetHealthRegistry() *HealthRegistry
+	// GetMetrics 返回请求指标,未开启 Config.EnableMetrics 时返回 nil
+	GetMetrics() *Metrics
 }
 
+// NewService 创建服务,配置错误时记录日志并返回 nil,需要获取错误时使用 NewServiceWithError
 func NewService(config *Config) Service {
-	log.Debug(fmt.Sprintf("[%s]HTTP服务器配置", config.AppName))
+	service, err := NewServiceWithError(config)
+	if err != nil {
+		log.Error("创建HTTP服务失败", zap.Error(err))
+		return nil
+	}
+	return service
+}
+
+// NewServiceWithError 创建服务,配置不合法、证书或监听地址不可用时返回错误
+func NewServiceWithError(config *Config) (Service, error) {
 	if config == nil {
 		config = GetDefaultConfig("", "test")
 	}
+	log.Debug(fmt.Sprintf("[%s]HTTP服务器配置", config.AppName))
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("[%s]HTTP服务配置错误: %w", config.AppName, err)
+	}
 	engine := fiber.New(fiber.Config{
 		Prefork:               config.Prefork,
 		CaseSensitive:         config.CaseSensitive,
@@ -38,10 +78,6 @@ func NewService(config *Config) Service {
 		ReadBufferSize:        config.ReadBufferSize,
 		WriteBufferSize:       config.WriteBufferSize,
 
-		//TLSConfig: config.TLSConfig
-		//TLSNextProto map[string]func(*http.Server, *tls.Conn, http.Handler)
-		//ConnState    func(net.Conn, http.ConnState)
-
 		Immutable:         config.Immutable,
 		UnescapePath:      config.UnescapePath,
 		ETag:              config.ETag,
@@ -64,27 +100,85 @@ func NewService(config *Config) Service {
 		EnablePrintRoutes:            config.EnablePrintRoutes,
 		Views:                        config.Views,
 		ViewsLayout:                  config.ViewsLayout,
-		ErrorHandler:                 config.ErrorHandler,
+		ErrorHandler:                 config.getErrorHandler(),
 	})
+	engine.Server().ConnState = wrapConnState(config.ConnState)
+	if !config.DisableRequestID {
+		engine.Use(RequestIDMiddleware(config.RequestIDHeader))
+	}
+	clientCAs, err := loadClientCAs(config.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("[%s]加载客户端CA证书失败: %w", config.AppName, err)
+	}
+	var admin *fiber.App
+	opsRouter := engine
+	if config.AdminAddr != "" {
+		admin, err = newAdminEngine(config)
+		if err != nil {
+			return nil, fmt.Errorf("[%s]创建运维服务失败: %w", config.AppName, err)
+		}
+		opsRouter = admin
+	}
+	if err := RegisterPprof(opsRouter, config.Pprof); err != nil {
+		return nil, fmt.Errorf("[%s]挂载pprof失败: %w", config.AppName, err)
+	}
+	var metrics *Metrics
+	if config.EnableMetrics {
+		metrics, err = NewMetrics(config.AppName)
+		if err != nil {
+			return nil, fmt.Errorf("[%s]注册请求指标失败: %w", config.AppName, err)
+		}
+		engine.Use(metrics.Middleware())
+		metrics.Register(opsRouter)
+	}
+	health := NewHealthRegistry(config.getHealthCacheInterval())
+	if config.EnableHealthCheck {
+		health.RegisterHandlers(opsRouter)
+	}
+	if !config.ManualStartup {
+		engine.Hooks().OnListen(func(fiber.ListenData) error {
+			health.SetStarted()
+			return nil
+		})
+	}
 	l, err := Listen(config.getServerAddr())
 	if err != nil {
-		log.Error(fmt.Sprintf("[%s]创建HTTP服务失败", config.AppName), zap.Error(err))
-		return nil
+		return nil, fmt.Errorf("[%s]创建HTTP服务失败: %w", config.AppName, err)
 	}
 	config.ServerAddr = l.Addr().String()
 	l.Close()
 	impl := &serviceImpl{
-		name:   config.AppName,
-		config: config,
-		engine: engine,
+		name:      config.AppName,
+		config:    config,
+		engine:    engine,
+		admin:     admin,
+		health:    health,
+		metrics:   metrics,
+		tracker:   newConnTracker(),
+		clientCAs: clientCAs,
 	}
-	return impl
+	return impl, nil
 }
 
 type serviceImpl struct {
-	name   string
-	config *Config
-	engine *fiber.App
+	name    string
+	config  *Config
+	engine  *fiber.App
+	tracker *connTracker
+	// admin 运维端口的应用,未配置 AdminAddr 时为空
+	admin     *fiber.App
+	adminOnce sync.Once
+	// adminListener 运维端口的监听,启动后才不为空
+	adminListener net.Listener
+	health        *HealthRegistry
+	metrics       *Metrics
+	// clientCAs 不为空时以mTLS方式提供服务
+	clientCAs *x509.CertPool
+
+	mutex        sync.Mutex
+	certInfo     *httpxcommons.CertificateInfo
+	onShutdowns  []func()
+	shutdownOnce sync.Once
 }
 
 func (impl *serviceImpl) NewRouterGroup(prefix string) fiber.Router {
@@ -96,41 +190,199 @@ func (impl *serviceImpl) GetServerAddress() string {
 }
 
 func (impl *serviceImpl) Shutdown() error {
-	err := impl.engine.Shutdown()
+	return impl.ShutdownWithContext(context.Background())
+}
+
+func (impl *serviceImpl) ShutdownWithContext(ctx context.Context) error {
+	impl.health.SetShuttingDown()
+	if delay := impl.config.getShutdownDelay(); delay > 0 {
+		log.Info(fmt.Sprintf("[%s]等待负载均衡摘除流量", impl.name), zap.Duration("delay", delay))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+	drainCtx, cancel := context.WithTimeout(ctx, impl.config.getShutdownTimeout())
+	defer cancel()
+	err := impl.engine.ShutdownWithContext(drainCtx)
+	if adminErr := impl.shutdownAdmin(drainCtx); err == nil {
+		err = adminErr
+	}
 	if err != nil {
-		log.Error("关闭HttpServer失败", zap.Error(err))
+		if es.Is(err, context.DeadlineExceeded) || es.Is(err, context.Canceled) {
+			log.Warn(fmt.Sprintf("[%s]等待请求结束超时,强制关闭连接", impl.name), zap.Int("conns", impl.tracker.closeAll()))
+		} else {
+			log.Error("关闭HttpServer失败", zap.Error(err))
+		}
 	}
+	impl.runOnShutdowns()
 	return err
 }
 
+func (impl *serviceImpl) addOnShutdown(onShutdown func()) {
+	if onShutdown == nil {
+		return
+	}
+	impl.mutex.Lock()
+	defer impl.mutex.Unlock()
+	impl.onShutdowns = append(impl.onShutdowns, onShutdown)
+}
+
+func (impl *serviceImpl) runOnShutdowns() {
+	impl.shutdownOnce.Do(func() {
+		impl.mutex.Lock()
+		onShutdowns := impl.onShutdowns
+		impl.mutex.Unlock()
+		for _, onShutdown := range onShutdowns {
+			onShutdown()
+		}
+	})
+}
+
+func (impl *serviceImpl) GetHealthRegistry() *HealthRegistry {
+	return impl.health
+}
+
+func (impl *serviceImpl) GetMetrics() *Metrics {
+	return impl.metrics
+}
+
 func (impl *serviceImpl) GetEngine() *fiber.App {
 	return impl.engine
 }
 
 func (impl *serviceImpl) Start(onShutdown func()) <-chan error {
-	errorSign := make(chan error, 1)
-	go func() {
-		err := impl.engine.Listen(impl.config.getServerAddr())
-		if err != nil && err != http.ErrServerClosed {
-			log.Error(fmt.Sprintf("[%s]HTTP服务异常关闭", impl.name), zap.Error(err))
+	impl.addOnShutdown(onShutdown)
+	return impl.start(func() error {
+		if impl.config.Prefork {
+			return impl.engine.Listen(impl.config.getServerAddr())
 		}
-		log.Debug(fmt.Sprintf("[%s]HTTP服务关闭", impl.name))
-		errorSign <- err
-	}()
-	log.Debug(fmt.Sprintf("[%s]HTTP服务启动", impl.name), zap.String("address", impl.config.getServerAddr()))
-	return errorSign
+		if impl.config.TLSConfig != nil || impl.clientCAs != nil {
+			return impl.serve(prepareTLSConfig(impl.config.TLSConfig, impl.clientCAs))
+		}
+		return impl.serve(nil)
+	})
 }
 
 func (impl *serviceImpl) StartWithCertificate(cert tls.Certificate, onShutdown func()) <-chan error {
+	impl.addOnShutdown(onShutdown)
+	impl.inspectCertificate(cert)
+	return impl.start(func() error {
+		if impl.config.Prefork {
+			return impl.engine.ListenTLSWithCertificate(impl.config.getServerAddr(), cert)
+		}
+		return impl.serve(prepareTLSConfig(impl.config.TLSConfig, impl.clientCAs, cert))
+	})
+}
+
+func (impl *serviceImpl) StartWithCertificateSource(source CertificateSource, onShutdown func()) <-chan error {
+	impl.addOnShutdown(onShutdown)
+	if closer, ok := source.(io.Closer); ok {
+		impl.addOnShutdown(func() {
+			closer.Close()
+		})
+	}
+	// 没有 SNI 时 source 返回的证书作为服务的证书信息,证书重新加载后重新检查有效期
+	if cert, err := source.GetCertificate(&tls.ClientHelloInfo{}); err == nil && cert != nil {
+		impl.inspectCertificate(*cert)
+	}
+	if notifier, ok := source.(reloadNotifier); ok {
+		notifier.OnReload(impl.inspectCertificate)
+	}
+	return impl.start(func() error {
+		if impl.config.Prefork {
+			return errors.SystemError("Prefork模式不支持CertificateSource")
+		}
+		tlsConfig := prepareTLSConfig(impl.config.TLSConfig, impl.clientCAs)
+		tlsConfig.GetCertificate = source.GetCertificate
+		return impl.serve(tlsConfig)
+	})
+}
+
+func (impl *serviceImpl) GetCertificateInfo() *httpxcommons.CertificateInfo {
+	impl.mutex.Lock()
+	defer impl.mutex.Unlock()
+	return impl.certInfo
+}
+
+// reloadNotifier 证书更新后可以通知调用方的 CertificateSource,如 CertificateReloader
+type reloadNotifier interface {
+	OnReload(fn func(cert tls.Certificate))
+}
+
+// inspectCertificate 记录证书信息,证书即将过期时输出警告
+func (impl *serviceImpl) inspectCertificate(cert tls.Certificate) {
+	info, err := httpxcommons.InspectCertificate(cert)
+	if err != nil {
+		log.Error(fmt.Sprintf("[%s]解析证书失败", impl.name), zap.Error(err))
+		return
+	}
+	impl.mutex.Lock()
+	impl.certInfo = info
+	impl.mutex.Unlock()
+	if info.IsExpiringWithin(impl.config.getCertExpiryWarning()) {
+		log.Warn(fmt.Sprintf("[%s]证书即将过期", impl.name), zap.String("subject", info.Subject), zap.Time("not_after", info.NotAfter), zap.Float64("expires_in_seconds", info.ExpiresInSeconds()))
+	}
+}
+
+// start 启动运维端口和主服务,返回的 channel 在主服务停止时写入一次错误,
+// 运维端口启动失败或异常停止时关闭主服务并写入运维服务的错误
+func (impl *serviceImpl) start(listen func() error) <-chan error {
 	errorSign := make(chan error, 1)
+	adminErrs, err := impl.startAdmin()
+	if err != nil {
+		log.Error(fmt.Sprintf("[%s]运维服务启动失败", impl.name), zap.Error(err))
+		errorSign <- err
+		return errorSign
+	}
+	serveErrs := make(chan error, 1)
 	go func() {
-		err := impl.engine.ListenTLSWithCertificate(impl.config.getServerAddr(), cert)
+		err := listen()
 		if err != nil && err != http.ErrServerClosed {
 			log.Error(fmt.Sprintf("[%s]HTTP服务异常关闭", impl.name), zap.Error(err))
 		}
 		log.Debug(fmt.Sprintf("[%s]HTTP服务关闭", impl.name))
-		errorSign <- err
+		serveErrs <- err
+	}()
+	go func() {
+		select {
+		case err := <-serveErrs:
+			// 主服务异常停止时同时关闭运维端口,正常关闭时由 ShutdownWithContext 关闭
+			if adminErrs != nil && err != nil && err != http.ErrServerClosed {
+				impl.shutdownAdmin(context.Background())
+			}
+			errorSign <- err
+		case err := <-adminErrs:
+			if shutdownErr := impl.engine.ShutdownWithTimeout(impl.config.getShutdownTimeout()); shutdownErr != nil {
+				log.Error(fmt.Sprintf("[%s]关闭HTTP服务失败", impl.name), zap.Error(shutdownErr))
+			}
+			<-serveErrs
+			errorSign <- err
+		}
 	}()
 	log.Debug(fmt.Sprintf("[%s]HTTP服务启动", impl.name), zap.String("address", impl.config.getServerAddr()))
 	return errorSign
 }
+
+// serve 使用可跟踪的 listener 启动服务,tlsConfig 不为空时以 TLS 方式提供服务
+func (impl *serviceImpl) serve(tlsConfig *tls.Config) error {
+	l, err := Listen(impl.config.getServerAddr())
+	if err != nil {
+		return err
+	}
+	var ln net.Listener = trackedListener{Listener: l, tracker: impl.tracker}
+	if tlsConfig != nil {
+		if !hasCertificate(tlsConfig) {
+			l.Close()
+			return errors.SystemError("TLSConfig没有配置证书")
+		}
+		applyTLSNextProto(impl.engine, tlsConfig, impl.config.TLSNextProto)
+		tlsHandler := &fiber.TLSHandler{}
+		if tlsConfig.GetCertificate == nil {
+			tlsConfig.GetCertificate = tlsHandler.GetClientInfo
+		}
+		impl.engine.SetTLSHandler(tlsHandler)
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	return impl.engine.Listener(ln)
+}
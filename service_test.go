@@ -0,0 +1,182 @@
+package httpx
+
+import (
+	"context"
+	"crypto/tls"
+	es "errors"
+	"github.com/gofiber/fiber/v2"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewServiceWithErrorInvalidConfig(t *testing.T) {
+	config := GetDefaultConfig("127.0.0.1:0", "test")
+	config.Prefork = true
+	config.TLSConfig = &tls.Config{}
+	service, err := NewServiceWithError(config)
+	if err == nil || service != nil {
+		t.Fatalf("Prefork 与 TLSConfig 同时配置时应返回错误, got service=%v err=%v", service, err)
+	}
+	if NewService(config) != nil {
+		t.Fatal("配置错误时 NewService 应返回 nil")
+	}
+}
+
+func TestNewServiceWithErrorAddressInUse(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := NewServiceWithError(GetDefaultConfig(l.Addr().String(), "test")); err == nil {
+		t.Fatal("监听地址被占用时应返回错误")
+	}
+}
+
+func TestNewServiceWithError(t *testing.T) {
+	service, err := NewServiceWithError(GetDefaultConfig("127.0.0.1:0", "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service.GetServerAddress() == "127.0.0.1:0" {
+		t.Fatal("监听地址中的端口应被解析为实际端口")
+	}
+}
+
+// shutdownRecorder 按发生顺序记录关闭过程中的事件
+type shutdownRecorder struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (r *shutdownRecorder) add(event string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *shutdownRecorder) get() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+type getResult struct {
+	body string
+	err  error
+}
+
+// getAsync 在后台发起不复用连接的 GET 请求
+func getAsync(url string) <-chan getResult {
+	result := make(chan getResult, 1)
+	go func() {
+		client := &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{DisableKeepAlives: true}}
+		resp, err := client.Get(url)
+		if err != nil {
+			result <- getResult{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		result <- getResult{body: string(data), err: err}
+	}()
+	return result
+}
+
+// 进行中的请求在 ShutdownTimeoutMs 内结束时正常返回,onShutdown 回调在请求结束后执行
+func TestShutdownDrainsInFlight(t *testing.T) {
+	recorder := &shutdownRecorder{}
+	service := newTestService(t, func(config *Config) {
+		config.ShutdownTimeoutMs = 5000
+	})
+	started := make(chan struct{})
+	service.GetEngine().Get("/slow", func(c *fiber.Ctx) error {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		recorder.add("handler")
+		return c.SendString("done")
+	})
+	service.Start(func() { recorder.add("hook") })
+	addr := service.GetServerAddress()
+	waitListening(t, addr)
+	result := getAsync("http://" + addr + "/slow")
+	<-started
+	if err := service.ShutdownWithContext(context.Background()); err != nil {
+		t.Fatalf("请求在超时前结束时不应返回错误: %v", err)
+	}
+	recorder.add("shutdown")
+	if r := <-result; r.err != nil || r.body != "done" {
+		t.Fatalf("进行中的请求应正常结束, body=%q err=%v", r.body, r.err)
+	}
+	if events := recorder.get(); !equalEvents(events, "handler", "hook", "shutdown") {
+		t.Fatalf("事件顺序错误: %v", events)
+	}
+	if _, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		t.Fatal("关闭后不应再接收新连接")
+	}
+}
+
+// 超过 ShutdownTimeoutMs 后强制关闭残留连接,然后执行 onShutdown 回调
+func TestShutdownForceClosesConnections(t *testing.T) {
+	recorder := &shutdownRecorder{}
+	service := newTestService(t, func(config *Config) {
+		config.ShutdownTimeoutMs = 100
+	})
+	tracker := service.(*serviceImpl).tracker
+	started := make(chan struct{})
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	service.GetEngine().Get("/stuck", func(c *fiber.Ctx) error {
+		close(started)
+		<-release
+		return c.SendString("done")
+	})
+	service.Start(func() {
+		tracker.mutex.Lock()
+		defer tracker.mutex.Unlock()
+		if len(tracker.conns) == 0 {
+			recorder.add("hook")
+		} else {
+			recorder.add("hook with open conns")
+		}
+	})
+	addr := service.GetServerAddress()
+	waitListening(t, addr)
+	result := getAsync("http://" + addr + "/stuck")
+	<-started
+	start := time.Now()
+	err := service.ShutdownWithContext(context.Background())
+	if !es.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("等待超时时应返回 context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("ShutdownTimeoutMs 到期后应立即返回, elapsed=%s", elapsed)
+	}
+	select {
+	case r := <-result:
+		if r.err == nil {
+			t.Fatalf("连接被强制关闭时请求应失败, got %q", r.body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("残留连接没有被关闭")
+	}
+	if events := recorder.get(); !equalEvents(events, "hook") {
+		t.Fatalf("onShutdown 应在强制关闭连接后执行: %v", events)
+	}
+}
+
+func equalEvents(events []string, want ...string) bool {
+	if len(events) != len(want) {
+		return false
+	}
+	for i := range events {
+		if events[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package httpx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/protobuf/proto"
+	"io"
+)
+
+// BodyReader 返回请求体的读取器,开启 Config.StreamRequestBody 时请求体不会整体读入内存
+func BodyReader(c *fiber.Ctx) io.Reader {
+	if c.Request().IsBodyStream() {
+		return c.Context().RequestBodyStream()
+	}
+	return bytes.NewReader(c.Body())
+}
+
+// budgetReader 限制最多读取 budget 字节,超出时返回 fiber.ErrRequestEntityTooLarge
+type budgetReader struct {
+	r      io.Reader
+	budget int64
+}
+
+func newBudgetReader(r io.Reader, budget int64) io.Reader {
+	if budget <= 0 {
+		return r
+	}
+	return &budgetReader{r: r, budget: budget}
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	if r.budget < 0 {
+		return 0, fiber.ErrRequestEntityTooLarge
+	}
+	if int64(len(p)) > r.budget+1 {
+		p = p[:r.budget+1]
+	}
+	n, err := r.r.Read(p)
+	r.budget -= int64(n)
+	if r.budget < 0 {
+		return n, fiber.ErrRequestEntityTooLarge
+	}
+	return n, err
+}
+
+// DefaultMaxJSONItemBytes DecodeJSONStream 未指定单条 JSON 大小时的默认上限
+const DefaultMaxJSONItemBytes = 4 * 1024 * 1024
+
+// DecodeJSONStream 逐条解析请求体中的 JSON 数组或 NDJSON(每行一个 JSON),每解析一条调用一次 fn,
+// maxBytes 为允许读取的最大字节数,小于等于0时不限制,maxItemBytes 为单条 JSON 的最大字节数,
+// 小于等于0时使用 DefaultMaxJSONItemBytes
+func DecodeJSONStream[T any](c *fiber.Ctx, maxBytes int64, maxItemBytes int, fn func(item *T) error) error {
+	if maxItemBytes <= 0 {
+		maxItemBytes = DefaultMaxJSONItemBytes
+	}
+	reader := bufio.NewReader(newBudgetReader(BodyReader(c), maxBytes))
+	array, err := isJSONArray(reader)
+	if err != nil {
+		return err
+	}
+	items := &itemReader{r: reader}
+	decoder := json.NewDecoder(items)
+	if EnableDecoderUseNumber {
+		decoder.UseNumber()
+	}
+	// 每条 JSON 开始前重新计算可读取的上限,json.Decoder 只有当前值不完整时才继续读取
+	nextItem := func() {
+		items.limit = decoder.InputOffset() + int64(maxItemBytes) + 1
+	}
+	nextItem()
+	if array {
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+	}
+	for nextItem(); decoder.More(); nextItem() {
+		item := new(T)
+		if err := decoder.Decode(item); err != nil {
+			return err
+		}
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	if array {
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// itemReader 最多读取到 limit 字节,超出时返回 fiber.ErrRequestEntityTooLarge
+type itemReader struct {
+	r     io.Reader
+	read  int64
+	limit int64
+}
+
+func (r *itemReader) Read(p []byte) (int, error) {
+	remaining := r.limit - r.read
+	if remaining <= 0 {
+		return 0, fiber.ErrRequestEntityTooLarge
+	}
+	if int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := r.r.Read(p)
+	r.read += int64(n)
+	return n, err
+}
+
+// isJSONArray 跳过空白字符后判断请求体是否为 JSON 数组
+func isJSONArray(reader *bufio.Reader) (bool, error) {
+	for {
+		b, err := reader.Peek(1)
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			reader.ReadByte()
+		default:
+			return b[0] == '[', nil
+		}
+	}
+}
+
+// DefaultMaxProtoItemBytes DecodeDelimitedProto 未指定单条消息大小时的默认上限
+const DefaultMaxProtoItemBytes = 4 * 1024 * 1024
+
+// DecodeDelimitedProto 逐条解析请求体中以 varint 长度为前缀的 protobuf 消息,每解析一条调用一次 fn,
+// maxBytes 为允许读取的最大字节数,小于等于0时不限制,maxItemBytes 为单条消息的最大字节数,
+// 小于等于0时使用 DefaultMaxProtoItemBytes
+func DecodeDelimitedProto[T any, P interface {
+	*T
+	proto.Message
+}](c *fiber.Ctx, maxBytes int64, maxItemBytes int, fn func(msg P) error) error {
+	if maxItemBytes <= 0 {
+		maxItemBytes = DefaultMaxProtoItemBytes
+	}
+	reader := bufio.NewReader(newBudgetReader(BodyReader(c), maxBytes))
+	buf := &bytes.Buffer{}
+	for {
+		size, err := binary.ReadUvarint(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if size > uint64(maxItemBytes) || (maxBytes > 0 && size > uint64(maxBytes)) {
+			return fiber.ErrRequestEntityTooLarge
+		}
+		// 长度前缀由客户端提供,按实际读取的数据增长缓冲区,不按声明的长度预先分配
+		buf.Reset()
+		if n, err := io.CopyN(buf, reader, int64(size)); err != nil {
+			if err == io.EOF && n < int64(size) {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		msg := P(new(T))
+		if err := proto.Unmarshal(buf.Bytes(), msg); err != nil {
+			return err
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+}
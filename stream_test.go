@@ -0,0 +1,163 @@
+package httpx
+
+import (
+	"bytes"
+	"encoding/binary"
+	es "errors"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// decodeDelimited 使用 DecodeDelimitedProto 解析 body,返回解析出的消息和错误
+func decodeDelimited(t *testing.T, body []byte, maxBytes int64, maxItemBytes int) ([]string, error) {
+	t.Helper()
+	app := fiber.New()
+	var fields []string
+	var decodeErr error
+	app.Post("/", func(c *fiber.Ctx) error {
+		decodeErr = DecodeDelimitedProto[httpxcommons.FieldError](c, maxBytes, maxItemBytes, func(msg *httpxcommons.FieldError) error {
+			fields = append(fields, msg.GetField())
+			return nil
+		})
+		return nil
+	})
+	if _, err := app.Test(httptest.NewRequest(fiber.MethodPost, "/", bytes.NewReader(body))); err != nil {
+		t.Fatal(err)
+	}
+	return fields, decodeErr
+}
+
+func appendDelimited(t *testing.T, body []byte, msg proto.Message) []byte {
+	t.Helper()
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body = binary.AppendUvarint(body, uint64(len(data)))
+	return append(body, data...)
+}
+
+func TestDecodeDelimitedProto(t *testing.T) {
+	var body []byte
+	body = appendDelimited(t, body, &httpxcommons.FieldError{Field: "a"})
+	body = appendDelimited(t, body, &httpxcommons.FieldError{Field: "b"})
+	fields, err := decodeDelimited(t, body, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 2 || fields[0] != "a" || fields[1] != "b" {
+		t.Fatalf("got %v", fields)
+	}
+	if _, err := decodeDelimited(t, body[:len(body)-1], 0, 0); !es.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("消息不完整时应返回 io.ErrUnexpectedEOF, got %v", err)
+	}
+	if _, err := decodeDelimited(t, body, 0, 2); !es.Is(err, fiber.ErrRequestEntityTooLarge) {
+		t.Fatalf("超过 maxItemBytes 时应返回413, got %v", err)
+	}
+}
+
+// 客户端声明的超大长度前缀不能导致按该长度分配内存
+func TestDecodeDelimitedProtoHugeLength(t *testing.T) {
+	for _, size := range []uint64{1 << 62, 1 << 40, DefaultMaxProtoItemBytes + 1} {
+		body := binary.AppendUvarint(nil, size)
+		if _, err := decodeDelimited(t, append(body, 0x0a, 0x01, 'a'), 0, 0); !es.Is(err, fiber.ErrRequestEntityTooLarge) {
+			t.Fatalf("长度前缀为%d时应返回413, got %v", size, err)
+		}
+	}
+	// 长度在限制内但实际数据不足时只分配已读取的数据
+	body := binary.AppendUvarint(nil, DefaultMaxProtoItemBytes)
+	if _, err := decodeDelimited(t, append(body, 0x0a, 0x01, 'a'), 0, 0); !es.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+type streamItem struct {
+	Name string `json:"name"`
+}
+
+// decodeJSONStream 使用 DecodeJSONStream 解析 body,返回解析出的 name 和错误
+func decodeJSONStream(t *testing.T, body string, maxItemBytes int) ([]string, error) {
+	t.Helper()
+	app := fiber.New(fiber.Config{BodyLimit: 2 * DefaultMaxJSONItemBytes})
+	var names []string
+	var decodeErr error
+	app.Post("/", func(c *fiber.Ctx) error {
+		decodeErr = DecodeJSONStream[streamItem](c, 0, maxItemBytes, func(i *streamItem) error {
+			names = append(names, i.Name)
+			return nil
+		})
+		return nil
+	})
+	if _, err := app.Test(httptest.NewRequest(fiber.MethodPost, "/", strings.NewReader(body))); err != nil {
+		t.Fatal(err)
+	}
+	return names, decodeErr
+}
+
+func TestDecodeJSONStream(t *testing.T) {
+	for _, body := range []string{`[{"name":"a"},{"name":"b"}]`, "{\"name\":\"a\"}\n{\"name\":\"b\"}\n"} {
+		names, err := decodeJSONStream(t, body, 0)
+		if err != nil || len(names) != 2 || names[1] != "b" {
+			t.Fatalf("body %q: names=%v err=%v", body, names, err)
+		}
+	}
+}
+
+// 单条 JSON 超过 maxItemBytes 时返回413,总大小不受影响
+func TestDecodeJSONStreamItemLimit(t *testing.T) {
+	item := `{"name":"` + strings.Repeat("a", 100) + `"}`
+	for _, body := range []string{"[" + strings.Repeat(item+",", 19) + item + "]", strings.Repeat(item+"\n", 20)} {
+		names, err := decodeJSONStream(t, body, len(item)+2)
+		if err != nil || len(names) != 20 {
+			t.Fatalf("每条都在限制内时应全部解析, names=%d err=%v", len(names), err)
+		}
+		if _, err := decodeJSONStream(t, body, len(item)-10); !es.Is(err, fiber.ErrRequestEntityTooLarge) {
+			t.Fatalf("超过 maxItemBytes 时应返回413, got %v", err)
+		}
+	}
+	huge := `{"name":"` + strings.Repeat("a", DefaultMaxJSONItemBytes) + `"}`
+	if _, err := decodeJSONStream(t, huge, 0); !es.Is(err, fiber.ErrRequestEntityTooLarge) {
+		t.Fatalf("超过 DefaultMaxJSONItemBytes 时应返回413, got %v", err)
+	}
+}
+
+// 开启 StreamRequestBody 时超过 BodyLimit 的请求体也能逐条解析,不会整体读入内存
+func TestDecodeJSONStreamLargeBody(t *testing.T) {
+	const count = 20000
+	app := fiber.New(fiber.Config{DisableStartupMessage: true, StreamRequestBody: true, BodyLimit: 4096})
+	app.Post("/", func(c *fiber.Ctx) error {
+		if !c.Request().IsBodyStream() {
+			return c.SendStatus(fiber.StatusExpectationFailed)
+		}
+		total := 0
+		err := DecodeJSONStream[streamItem](c, 0, 0, func(i *streamItem) error {
+			total++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return c.SendString(strconv.Itoa(total))
+	})
+	url := serveApp(t, app)
+	body := strings.Repeat(`{"name":"item"}`+"\n", count)
+	if len(body) <= 4096 {
+		t.Fatal("请求体应超过 BodyLimit")
+	}
+	resp, err := http.Post(url, fiber.MIMEApplicationJSON, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != fiber.StatusOK || string(data) != strconv.Itoa(count) {
+		t.Fatalf("status=%d body=%s", resp.StatusCode, data)
+	}
+}
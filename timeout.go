@@ -0,0 +1,173 @@
+package httpx
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/coffeehc/base/log"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+	"net"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// TimeoutConfig 请求超时配置
+type TimeoutConfig struct {
+	// Timeout 默认超时时间,小于等于0时不限制
+	Timeout time.Duration
+	// Prefixes 按路径前缀(以路径段为单位)覆盖超时时间,多个前缀匹配时使用最长的前缀,设置为0时不限制,
+	// 可以配合 Route 为其中的路由单独设置超时时间
+	Prefixes map[string]time.Duration
+	// StatusCode 超时响应的状态码,默认为503,也可以设置为408
+	StatusCode int
+	// Message 超时响应的错误信息,默认为"请求超时"
+	Message string
+}
+
+// RequestTimeout 在超时时间到达时立即向客户端返回错误,不等待处理器结束。
+// 超时后处理器仍会继续执行直到返回(Go 无法强制终止协程),期间它对响应的写入会被丢弃,
+// 外层中间件在处理器返回后才能拿到超时响应的状态码,超时后连接会被关闭
+type RequestTimeout struct {
+	config    TimeoutConfig
+	abandoned atomic.Int64
+	running   atomic.Int64
+}
+
+func NewRequestTimeout(config TimeoutConfig) *RequestTimeout {
+	if config.StatusCode == 0 {
+		config.StatusCode = fiber.StatusServiceUnavailable
+	}
+	if config.Message == "" {
+		config.Message = "请求超时"
+	}
+	return &RequestTimeout{config: config}
+}
+
+// AbandonedTotal 返回累计超时被放弃的处理器数量
+func (impl *RequestTimeout) AbandonedTotal() int64 {
+	return impl.abandoned.Load()
+}
+
+// AbandonedRunning 返回已经超时但仍在执行的处理器数量
+func (impl *RequestTimeout) AbandonedRunning() int64 {
+	return impl.running.Load()
+}
+
+func (impl *RequestTimeout) timeoutFor(c *fiber.Ctx) time.Duration {
+	timeout, matched := impl.config.Timeout, ""
+	for prefix, t := range impl.config.Prefixes {
+		if len(prefix) > len(matched) && hasPathPrefix(c.Path(), prefix) {
+			timeout, matched = t, prefix
+		}
+	}
+	return timeout
+}
+
+// hasPathPrefix 按路径段匹配前缀,/export 匹配 /export 和 /export/x,不匹配 /exporter
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// handlerResult 处理器的返回值,panic 不为空时表示处理器发生了 panic
+type handlerResult struct {
+	err   error
+	panic interface{}
+	stack []byte
+}
+
+// Middleware 返回超时中间件,按 Timeout 和 Prefixes 确定超时时间,处理器应使用 c.UserContext() 以便在超时后尽快结束
+func (impl *RequestTimeout) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return impl.handle(c, impl.timeoutFor(c))
+	}
+}
+
+// Route 返回挂载在单个路由上的超时中间件,如 app.Get("/export", timeouts.Route(time.Minute), handler)。
+// 通过 Use 挂载的中间件在路由匹配之前执行,无法按路由区分超时时间,同时使用 Middleware 时
+// 需要通过 Prefixes 将这些路由设置为不限制,否则较短的超时会先生效
+func (impl *RequestTimeout) Route(timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return impl.handle(c, timeout)
+	}
+}
+
+func (impl *RequestTimeout) handle(c *fiber.Ctx, timeout time.Duration) error {
+	if timeout <= 0 {
+		return c.Next()
+	}
+	accept := strings.Clone(c.Get(fiber.HeaderAccept))
+	requestID := httpxcommons.GetRequestID(c)
+	// 保留外层中间件已经设置的响应头(如 X-Request-ID),超时响应中同样输出
+	header := &fasthttp.ResponseHeader{}
+	c.Response().Header.CopyTo(header)
+	ctx, cancel := context.WithTimeout(c.UserContext(), timeout)
+	defer cancel()
+	c.SetUserContext(ctx)
+	done := make(chan handlerResult, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- handlerResult{panic: r, stack: debug.Stack()}
+			}
+		}()
+		done <- handlerResult{err: c.Next()}
+	}()
+	select {
+	case result := <-done:
+		if result.panic != nil {
+			// 在当前协程重新 panic,保留处理器协程的调用栈
+			panic(&PanicError{Value: result.panic, Stack: result.stack})
+		}
+		return result.err
+	case <-ctx.Done():
+	}
+	impl.abandoned.Add(1)
+	impl.running.Add(1)
+	resp := impl.sendTimeout(c, header, accept, requestID)
+	log.Warn("请求处理超时", zap.String("method", c.Method()), zap.String("path", c.Path()), zap.String("request_id", requestID), zap.Duration("timeout", timeout))
+	// 等待处理器结束后才能返回,否则 fiber 会回收仍在使用中的 Ctx
+	result := <-done
+	impl.running.Add(-1)
+	if result.panic != nil {
+		log.Error(fmt.Sprintf("超时的处理器发生panic: %v", result.panic), zap.String("path", c.Path()), zap.String("request_id", requestID), zap.ByteString("stack", result.stack))
+	}
+	c.Response().Reset()
+	resp.CopyTo(c.Response())
+	fasthttp.ReleaseResponse(resp)
+	return nil
+}
+
+// sendTimeout 按协商的编码生成超时响应并直接写入连接,同时让 fasthttp 不再输出处理器的响应,
+// 返回的响应用于在处理器结束后回填到 c 中供外层中间件使用
+func (impl *RequestTimeout) sendTimeout(c *fiber.Ctx, header *fasthttp.ResponseHeader, accept string, requestID string) *fasthttp.Response {
+	app := c.App()
+	tmp := app.AcquireCtx(&fasthttp.RequestCtx{})
+	defer app.ReleaseCtx(tmp)
+	header.CopyTo(&tmp.Response().Header)
+	tmp.Request().Header.Set(fiber.HeaderAccept, accept)
+	httpxcommons.SetRequestID(tmp, requestID)
+	if err := httpxcommons.SendError(tmp, impl.config.Message, int64(impl.config.StatusCode), impl.config.StatusCode); err != nil {
+		log.Error("生成超时响应失败", zap.Error(err))
+	}
+	tmp.Response().SetConnectionClose()
+	resp := fasthttp.AcquireResponse()
+	tmp.Response().CopyTo(resp)
+	fctx := c.Context()
+	fctx.HijackSetNoResponse(true)
+	fctx.Hijack(func(net.Conn) {})
+	w := bufio.NewWriter(fctx.Conn())
+	err := resp.Write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		log.Error("输出超时响应失败", zap.Error(err))
+	}
+	return resp
+}
@@ -0,0 +1,106 @@
+package httpx
+
+import (
+	"bytes"
+	"github.com/gofiber/fiber/v2"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// waitDone 等待 c.UserContext() 超时后返回
+func waitDone(c *fiber.Ctx) error {
+	<-c.UserContext().Done()
+	return nil
+}
+
+func TestRequestTimeoutRoute(t *testing.T) {
+	timeouts := NewRequestTimeout(TimeoutConfig{
+		Timeout:  20 * time.Millisecond,
+		Prefixes: map[string]time.Duration{"/export": 0},
+	})
+	app := fiber.New()
+	app.Use(timeouts.Middleware())
+	app.Get("/slow", waitDone)
+	app.Get("/export/fast", timeouts.Route(time.Second), func(c *fiber.Ctx) error {
+		time.Sleep(50 * time.Millisecond)
+		return c.SendString("ok")
+	})
+	app.Get("/export/slow", timeouts.Route(20*time.Millisecond), waitDone)
+	cases := map[string]int{"/slow": fiber.StatusServiceUnavailable, "/export/fast": fiber.StatusOK, "/export/slow": fiber.StatusServiceUnavailable}
+	for path, status := range cases {
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, path, nil), 5000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != status {
+			t.Fatalf("%s: status=%d", path, resp.StatusCode)
+		}
+	}
+	if total := timeouts.AbandonedTotal(); total != 2 {
+		t.Fatalf("AbandonedTotal=%d", total)
+	}
+}
+
+func panicInHandler(c *fiber.Ctx) error {
+	panic("boom")
+}
+
+// 处理器协程中的 panic 交给 RecoveryMiddleware 时保留原始值和调用栈
+func TestRequestTimeoutPanicStack(t *testing.T) {
+	var recovered interface{}
+	var stack []byte
+	app := fiber.New()
+	app.Use(RecoveryMiddleware(RecoveryConfig{DisableStackTrace: true, PanicHook: func(c *fiber.Ctx, r interface{}, s []byte) {
+		recovered, stack = r, s
+	}}))
+	app.Use(NewRequestTimeout(TimeoutConfig{Timeout: time.Second}).Middleware())
+	app.Get("/", panicInHandler)
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusInternalServerError {
+		t.Fatalf("status=%d", resp.StatusCode)
+	}
+	if recovered != "boom" {
+		t.Fatalf("PanicHook 应收到原始的 panic 值, got %#v", recovered)
+	}
+	if !bytes.Contains(stack, []byte("panicInHandler")) {
+		t.Fatalf("调用栈应包含发生 panic 的处理器:\n%s", stack)
+	}
+}
+
+// 前缀按路径段匹配,/export 的配置不影响 /exporter
+func TestRequestTimeoutPrefixSegment(t *testing.T) {
+	timeouts := NewRequestTimeout(TimeoutConfig{
+		Timeout:  20 * time.Millisecond,
+		Prefixes: map[string]time.Duration{"/export": 0},
+	})
+	app := fiber.New()
+	app.Use(timeouts.Middleware())
+	app.Get("/export", waitDone)
+	app.Get("/exporter", waitDone)
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/exporter", nil), 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusServiceUnavailable {
+		t.Fatalf("/exporter 应使用默认超时, status=%d", resp.StatusCode)
+	}
+	cases := []struct {
+		path, prefix string
+		want         bool
+	}{
+		{"/export", "/export", true},
+		{"/export/a", "/export", true},
+		{"/export/a", "/export/", true},
+		{"/exporter", "/export", false},
+		{"/any", "/", true},
+	}
+	for _, tc := range cases {
+		if got := hasPathPrefix(tc.path, tc.prefix); got != tc.want {
+			t.Fatalf("hasPathPrefix(%q, %q)=%v", tc.path, tc.prefix, got)
+		}
+	}
+}
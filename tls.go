@@ -0,0 +1,127 @@
+package httpx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/coffeehc/base/errors"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/valyala/fasthttp"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+)
+
+// validateTLSConfig 检查 TLSConfig 是否可用,避免配置错误在启动后才暴露
+func validateTLSConfig(config *tls.Config, hasClientCAs bool) error {
+	if config == nil {
+		return nil
+	}
+	if config.MaxVersion != 0 && config.MinVersion > config.MaxVersion {
+		return errors.SystemError("TLSConfig的MinVersion大于MaxVersion")
+	}
+	switch config.ClientAuth {
+	case tls.VerifyClientCertIfGiven, tls.RequireAndVerifyClientCert:
+		if !hasClientCAs && config.ClientCAs == nil && config.VerifyPeerCertificate == nil && config.GetConfigForClient == nil {
+			return errors.SystemError("TLSConfig要求校验客户端证书但没有配置ClientCAs")
+		}
+	}
+	return nil
+}
+
+func hasCertificate(config *tls.Config) bool {
+	return len(config.Certificates) > 0 || config.GetCertificate != nil || config.GetConfigForClient != nil
+}
+
+// prepareTLSConfig 复制基础配置并补齐默认值,certs 追加到证书列表,clientCAs 不为空时开启mTLS,
+// 基础配置没有设置 ClientAuth 时要求并校验客户端证书,设置了(如 VerifyClientCertIfGiven)时保留
+func prepareTLSConfig(base *tls.Config, clientCAs *x509.CertPool, certs ...tls.Certificate) *tls.Config {
+	var config *tls.Config
+	if base == nil {
+		config = &tls.Config{MinVersion: tls.VersionTLS12}
+	} else {
+		config = base.Clone()
+	}
+	config.Certificates = append(config.Certificates, certs...)
+	if clientCAs != nil {
+		if config.ClientAuth == tls.NoClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		config.ClientCAs = clientCAs
+	}
+	return config
+}
+
+func loadClientCAs(file string) (*x509.CertPool, error) {
+	if file == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return httpxcommons.LoadCertPool(raw)
+}
+
+// applyTLSNextProto 将 net/http 风格的 TLSNextProto 注册到 fasthttp,并加入 ALPN 协商列表
+func applyTLSNextProto(engine *fiber.App, config *tls.Config, nextProtos map[string]func(*http.Server, *tls.Conn, http.Handler)) {
+	if len(nextProtos) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(nextProtos))
+	for key := range nextProtos {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	handler := adaptor.FiberApp(engine)
+	server := &http.Server{Handler: handler}
+	for _, key := range keys {
+		fn := nextProtos[key]
+		engine.Server().NextProto(key, func(c net.Conn) error {
+			tlsConn, ok := c.(*tls.Conn)
+			if !ok {
+				return errors.SystemError("TLSNextProto只支持TLS连接")
+			}
+			fn(server, tlsConn, handler)
+			return nil
+		})
+		if !containsString(config.NextProtos, key) {
+			config.NextProtos = append(config.NextProtos, key)
+		}
+	}
+	if !containsString(config.NextProtos, "http/1.1") {
+		config.NextProtos = append(config.NextProtos, "http/1.1")
+	}
+}
+
+// wrapConnState 将 net/http 风格的 ConnState 回调适配到 fasthttp
+func wrapConnState(connState func(net.Conn, http.ConnState)) func(net.Conn, fasthttp.ConnState) {
+	if connState == nil {
+		return nil
+	}
+	return func(c net.Conn, state fasthttp.ConnState) {
+		switch state {
+		case fasthttp.StateNew:
+			connState(c, http.StateNew)
+		case fasthttp.StateActive:
+			connState(c, http.StateActive)
+		case fasthttp.StateIdle:
+			connState(c, http.StateIdle)
+		case fasthttp.StateHijacked:
+			connState(c, http.StateHijacked)
+		case fasthttp.StateClosed:
+			connState(c, http.StateClosed)
+		}
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,222 @@
+package httpx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"github.com/gofiber/fiber/v2"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func generateCertificate(t *testing.T, hosts ...string) tls.Certificate {
+	t.Helper()
+	cert, err := httpxcommons.GenerateSelfSignedCertificate(httpxcommons.SelfSignedOptions{Hosts: hosts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// writeCAFile 将 certs 的证书写入临时的 CA 证书包
+func writeCAFile(t *testing.T, certs ...tls.Certificate) string {
+	t.Helper()
+	var bundle []byte
+	for _, cert := range certs {
+		certPEM, _, err := httpxcommons.EncodeCertificatePEM(cert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bundle = append(bundle, certPEM...)
+	}
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(file, bundle, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// tlsClient 返回信任 serverCert 的客户端,clientCert 不为空时握手时总是提供该证书,
+// 即使它不是由服务端要求的CA签发的
+func tlsClient(serverCert tls.Certificate, clientCert ...tls.Certificate) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCert.Leaf)
+	config := &tls.Config{RootCAs: roots}
+	if len(clientCert) > 0 {
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return &clientCert[0], nil
+		}
+	}
+	return &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+			TLSClientConfig:   config,
+		},
+	}
+}
+
+// startTLSService 使用 serverCert 启动服务,挂载返回客户端证书 CommonName 的 /whoami
+func startTLSService(t *testing.T, serverCert tls.Certificate, configure func(config *Config)) Service {
+	t.Helper()
+	service := newTestService(t, configure)
+	service.GetEngine().Get("/whoami", func(c *fiber.Ctx) error {
+		if identity := GetPeerIdentity(c); identity != nil {
+			return c.SendString(identity.CommonName)
+		}
+		return c.SendString("anonymous")
+	})
+	service.StartWithCertificate(serverCert, nil)
+	t.Cleanup(func() {
+		service.Shutdown()
+	})
+	waitListening(t, service.GetServerAddress())
+	return service
+}
+
+func whoami(client *http.Client, service Service) (string, error) {
+	resp, err := client.Get("https://" + service.GetServerAddress() + "/whoami")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return string(data), err
+}
+
+func TestMutualTLS(t *testing.T) {
+	serverCert := generateCertificate(t, "127.0.0.1")
+	clientCert := generateCertificate(t, "client.example")
+	otherCert := generateCertificate(t, "other.example")
+	caFile := writeCAFile(t, clientCert)
+	service := startTLSService(t, serverCert, func(config *Config) {
+		config.ClientCAFile = caFile
+	})
+	name, err := whoami(tlsClient(serverCert, clientCert), service)
+	if err != nil || name != "client.example" {
+		t.Fatalf("name=%q err=%v", name, err)
+	}
+	if _, err := whoami(tlsClient(serverCert), service); err == nil {
+		t.Fatal("没有客户端证书时握手应失败")
+	}
+	if _, err := whoami(tlsClient(serverCert, otherCert), service); err == nil {
+		t.Fatal("客户端证书不是由 ClientCAFile 中的CA签发时握手应失败")
+	}
+}
+
+// TLSConfig 设置 VerifyClientCertIfGiven 时客户端证书可选,提供了证书时仍然校验
+func TestMutualTLSOptional(t *testing.T) {
+	serverCert := generateCertificate(t, "127.0.0.1")
+	clientCert := generateCertificate(t, "client.example")
+	otherCert := generateCertificate(t, "other.example")
+	caFile := writeCAFile(t, clientCert)
+	service := startTLSService(t, serverCert, func(config *Config) {
+		config.ClientCAFile = caFile
+		config.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, ClientAuth: tls.VerifyClientCertIfGiven}
+	})
+	if name, err := whoami(tlsClient(serverCert), service); err != nil || name != "anonymous" {
+		t.Fatalf("没有客户端证书时应允许访问, name=%q err=%v", name, err)
+	}
+	if name, err := whoami(tlsClient(serverCert, clientCert), service); err != nil || name != "client.example" {
+		t.Fatalf("name=%q err=%v", name, err)
+	}
+	if _, err := whoami(tlsClient(serverCert, otherCert), service); err == nil {
+		t.Fatal("提供了无法校验的客户端证书时握手应失败")
+	}
+}
+
+func TestPrepareTLSConfigClientAuth(t *testing.T) {
+	pool := x509.NewCertPool()
+	cases := []struct {
+		base *tls.Config
+		want tls.ClientAuthType
+	}{
+		{nil, tls.RequireAndVerifyClientCert},
+		{&tls.Config{}, tls.RequireAndVerifyClientCert},
+		{&tls.Config{ClientAuth: tls.VerifyClientCertIfGiven}, tls.VerifyClientCertIfGiven},
+		{&tls.Config{ClientAuth: tls.RequireAndVerifyClientCert}, tls.RequireAndVerifyClientCert},
+	}
+	for _, tc := range cases {
+		config := prepareTLSConfig(tc.base, pool)
+		if config.ClientAuth != tc.want || config.ClientCAs != pool {
+			t.Fatalf("base=%+v: ClientAuth=%s", tc.base, config.ClientAuth)
+		}
+		if tc.base != nil && tc.base.ClientCAs != nil {
+			t.Fatal("不应修改传入的 TLSConfig")
+		}
+	}
+	if config := prepareTLSConfig(nil, nil); config.ClientAuth != tls.NoClientCert || config.MinVersion != tls.VersionTLS12 {
+		t.Fatalf("没有 ClientCAs 时不应要求客户端证书, got %+v", config)
+	}
+}
+
+func TestConnState(t *testing.T) {
+	var mutex sync.Mutex
+	seen := make(map[http.ConnState]int)
+	service := newTestService(t, func(config *Config) {
+		config.ConnState = func(c net.Conn, state http.ConnState) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			seen[state]++
+		}
+	})
+	service.Start(nil)
+	defer service.Shutdown()
+	waitListening(t, service.GetServerAddress())
+	if status := getStatus(t, "http://"+service.GetServerAddress()+"/missing"); status != fiber.StatusNotFound {
+		t.Fatalf("status=%d", status)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mutex.Lock()
+		done := seen[http.StateNew] >= 2 && seen[http.StateActive] >= 1 && seen[http.StateClosed] >= 2
+		mutex.Unlock()
+		if done {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ConnState 回调不完整: %v", seen)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TLSNextProto 注册的协议通过 ALPN 协商,其它请求仍然使用 http/1.1
+func TestTLSNextProto(t *testing.T) {
+	serverCert := generateCertificate(t, "127.0.0.1")
+	service := startTLSService(t, serverCert, func(config *Config) {
+		config.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){
+			"echo/1": func(server *http.Server, conn *tls.Conn, handler http.Handler) {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			},
+		}
+	})
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCert.Leaf)
+	conn, err := tls.Dial("tcp", service.GetServerAddress(), &tls.Config{RootCAs: roots, NextProtos: []string{"echo/1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if proto := conn.ConnectionState().NegotiatedProtocol; proto != "echo/1" {
+		t.Fatalf("NegotiatedProtocol=%q", proto)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("got %q err=%v", buf, err)
+	}
+	if name, err := whoami(tlsClient(serverCert), service); err != nil || name != "anonymous" {
+		t.Fatalf("name=%q err=%v", name, err)
+	}
+}
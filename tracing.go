@@ -0,0 +1,158 @@
+package httpx
+
+import (
+	"context"
+	"fmt"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"strings"
+)
+
+// tracerName 创建 Tracer 使用的 instrumentation 名称
+const tracerName = "github.com/coffeehc/httpx"
+
+// TracingConfig 链路追踪配置
+type TracingConfig struct {
+	// TracerProvider 为空时使用 otel.GetTracerProvider()
+	TracerProvider trace.TracerProvider
+	// Propagator 为空时使用 W3C traceparent/tracestate 和 baggage,EnableB3 时同时支持 B3 请求头
+	Propagator propagation.TextMapPropagator
+	// EnableB3 没有 traceparent 时从 B3 请求头(b3 单头或 X-B3-* 多头)中解析链路上下文,设置了 Propagator 时忽略
+	EnableB3 bool
+	// IgnoreClientErrors 为 true 时处理器返回的错误映射为4xx时不将 span 标记为错误,只记录错误事件
+	IgnoreClientErrors bool
+}
+
+func (impl *TracingConfig) getTracerProvider() trace.TracerProvider {
+	if impl.TracerProvider == nil {
+		impl.TracerProvider = otel.GetTracerProvider()
+	}
+	return impl.TracerProvider
+}
+
+func (impl *TracingConfig) getPropagator() propagation.TextMapPropagator {
+	if impl.Propagator == nil {
+		if impl.EnableB3 {
+			// 组合传播器按顺序解析,后面的覆盖前面的,traceparent 无效时保留 B3 的解析结果
+			impl.Propagator = propagation.NewCompositeTextMapPropagator(b3.New(), propagation.TraceContext{}, propagation.Baggage{})
+		} else {
+			impl.Propagator = defaultPropagator
+		}
+	}
+	return impl.Propagator
+}
+
+var defaultPropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// InjectTraceContext 将 ctx 中的链路上下文以 traceparent/tracestate 和 baggage 写入下游请求头,
+// 用于调用其它服务时传递链路,需要其它格式时直接使用对应 Propagator 的 Inject
+func InjectTraceContext(ctx context.Context, set func(key, value string)) {
+	defaultPropagator.Inject(ctx, funcCarrier(set))
+}
+
+// funcCarrier 只支持写入的 TextMapCarrier
+type funcCarrier func(key, value string)
+
+func (set funcCarrier) Get(key string) string {
+	return ""
+}
+
+func (set funcCarrier) Set(key, value string) {
+	set(key, value)
+}
+
+func (set funcCarrier) Keys() []string {
+	return nil
+}
+
+// requestHeaderCarrier 以请求头作为 TextMapCarrier,fiber 返回的字符串在请求结束后会被复用,读取时需要复制
+type requestHeaderCarrier struct {
+	c *fiber.Ctx
+}
+
+func (carrier requestHeaderCarrier) Get(key string) string {
+	return strings.Clone(carrier.c.Get(key))
+}
+
+func (carrier requestHeaderCarrier) Set(key, value string) {
+	carrier.c.Request().Header.Set(key, value)
+}
+
+func (carrier requestHeaderCarrier) Keys() []string {
+	keys := make([]string, 0)
+	carrier.c.Request().Header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
+
+// TracingMiddleware 为每个请求创建服务端 span,span 以匹配到的路由命名,处理器返回错误、状态码为5xx或发生 panic 时
+// 标记为错误并记录错误事件,span 通过 trace.SpanFromContext(c.UserContext()) 获取
+func TracingMiddleware(config TracingConfig) fiber.Handler {
+	tracer := config.getTracerProvider().Tracer(tracerName)
+	propagator := config.getPropagator()
+	return func(c *fiber.Ctx) error {
+		entry := c.Route()
+		ctx := propagator.Extract(c.UserContext(), requestHeaderCarrier{c: c})
+		// fiber 返回的字符串在请求结束后会被复用,span 中保存的值需要复制
+		ctx, span := tracer.Start(ctx, strings.Clone(c.Method()),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(strings.Clone(c.Method())),
+				semconv.URLPath(strings.Clone(c.Path())),
+				semconv.URLScheme(strings.Clone(c.Protocol())),
+				semconv.ClientAddress(strings.Clone(c.IP())),
+				semconv.UserAgentOriginal(strings.Clone(c.Get(fiber.HeaderUserAgent))),
+			))
+		c.SetUserContext(ctx)
+		defer func() {
+			if r := recover(); r != nil {
+				value, _ := unwrapPanic(r, nil)
+				endSpan(c, span, entry, fmt.Errorf("panic: %v", value), fiber.StatusInternalServerError, config.IgnoreClientErrors)
+				panic(r)
+			}
+		}()
+		err := c.Next()
+		endSpan(c, span, entry, err, responseStatus(c, err), config.IgnoreClientErrors)
+		return err
+	}
+}
+
+func endSpan(c *fiber.Ctx, span trace.Span, entry *fiber.Route, err error, status int, ignoreClientErrors bool) {
+	route := routeTemplate(c, entry, err)
+	if route != routeUnmatched {
+		span.SetName(c.Method() + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route))
+	}
+	span.SetAttributes(
+		semconv.HTTPResponseStatusCode(status),
+		semconv.HTTPRequestBodySize(requestSize(c)),
+		semconv.HTTPResponseBodySize(responseSize(c)),
+	)
+	if requestID := httpxcommons.GetRequestID(c); requestID != "" {
+		span.SetAttributes(attribute.String("http.request_id", requestID))
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	isError := status >= fiber.StatusInternalServerError
+	if err != nil && !(ignoreClientErrors && status < fiber.StatusInternalServerError) {
+		isError = true
+	}
+	if isError {
+		message := http.StatusText(status)
+		if err != nil {
+			message = err.Error()
+		}
+		span.SetStatus(codes.Error, message)
+	}
+	span.End()
+}
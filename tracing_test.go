@@ -0,0 +1,167 @@
+package httpx
+
+import (
+	es "errors"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID  = "00f067aa0ba902b7"
+)
+
+func newTracingApp(t *testing.T, config TracingConfig) (*fiber.App, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	config.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	app := fiber.New(fiber.Config{ErrorHandler: DefaultErrorHandler})
+	app.Use(RecoveryMiddleware(RecoveryConfig{DisableStackTrace: true}))
+	app.Use(TracingMiddleware(config))
+	return app, exporter
+}
+
+func doRequest(t *testing.T, app *fiber.App, target string, headers map[string]string) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodGet, target, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if _, err := app.Test(req); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func onlySpan(t *testing.T, exporter *tracetest.InMemoryExporter) tracetest.SpanStub {
+	t.Helper()
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("应导出1个span, got %d", len(spans))
+	}
+	return spans[0]
+}
+
+func spanAttribute(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracingTraceParent(t *testing.T) {
+	app, exporter := newTracingApp(t, TracingConfig{})
+	var fromHandler trace.SpanContext
+	var injected map[string]string
+	app.Get("/users/:id", func(c *fiber.Ctx) error {
+		fromHandler = trace.SpanFromContext(c.UserContext()).SpanContext()
+		injected = make(map[string]string)
+		InjectTraceContext(c.UserContext(), func(key, value string) {
+			injected[key] = value
+		})
+		return c.SendString("ok")
+	})
+	doRequest(t, app, "/users/1", map[string]string{"traceparent": "00-" + testTraceID + "-" + testSpanID + "-01", "tracestate": "vendor=value"})
+	span := onlySpan(t, exporter)
+	if span.Name != "GET /users/:id" || span.SpanKind != trace.SpanKindServer {
+		t.Fatalf("name=%s kind=%s", span.Name, span.SpanKind)
+	}
+	if span.Parent.TraceID().String() != testTraceID || span.Parent.SpanID().String() != testSpanID || !span.Parent.IsRemote() {
+		t.Fatalf("parent=%+v", span.Parent)
+	}
+	if span.SpanContext.TraceState().Get("vendor") != "value" {
+		t.Fatalf("tracestate=%s", span.SpanContext.TraceState())
+	}
+	if fromHandler.SpanID() != span.SpanContext.SpanID() {
+		t.Fatal("处理器中应能通过 trace.SpanFromContext 取得当前 span")
+	}
+	if want := "00-" + testTraceID + "-" + span.SpanContext.SpanID().String() + "-01"; injected["traceparent"] != want {
+		t.Fatalf("traceparent=%s, want %s", injected["traceparent"], want)
+	}
+	if route := spanAttribute(span, semconv.HTTPRouteKey).AsString(); route != "/users/:id" {
+		t.Fatalf("route=%s", route)
+	}
+	if status := spanAttribute(span, semconv.HTTPResponseStatusCodeKey).AsInt64(); status != fiber.StatusOK {
+		t.Fatalf("status=%d", status)
+	}
+}
+
+func TestTracingB3(t *testing.T) {
+	headers := map[string]string{"X-B3-TraceId": testTraceID, "X-B3-SpanId": testSpanID, "X-B3-Sampled": "1"}
+	for _, enable := range []bool{true, false} {
+		app, exporter := newTracingApp(t, TracingConfig{EnableB3: enable})
+		app.Get("/", func(c *fiber.Ctx) error {
+			return nil
+		})
+		doRequest(t, app, "/", headers)
+		span := onlySpan(t, exporter)
+		if got := span.SpanContext.TraceID().String() == testTraceID; got != enable {
+			t.Fatalf("EnableB3=%v 时 traceID=%s", enable, span.SpanContext.TraceID())
+		}
+	}
+	app, exporter := newTracingApp(t, TracingConfig{EnableB3: true})
+	app.Get("/", func(c *fiber.Ctx) error {
+		return nil
+	})
+	doRequest(t, app, "/", map[string]string{"b3": testTraceID + "-" + testSpanID + "-1"})
+	if span := onlySpan(t, exporter); span.Parent.SpanID().String() != testSpanID {
+		t.Fatalf("应支持 b3 单头, parent=%+v", span.Parent)
+	}
+}
+
+func TestTracingStatus(t *testing.T) {
+	cases := []struct {
+		path               string
+		status             int64
+		code               codes.Code
+		ignoreClientErrors bool
+	}{
+		{"/invalid", fiber.StatusBadRequest, codes.Error, false},
+		{"/invalid", fiber.StatusBadRequest, codes.Unset, true},
+		{"/failed", fiber.StatusInternalServerError, codes.Error, false},
+		{"/failed", fiber.StatusInternalServerError, codes.Error, true},
+		{"/panic", fiber.StatusInternalServerError, codes.Error, false},
+		{"/panic", fiber.StatusInternalServerError, codes.Error, true},
+	}
+	for _, tc := range cases {
+		app, exporter := newTracingApp(t, TracingConfig{IgnoreClientErrors: tc.ignoreClientErrors})
+		app.Get("/invalid", func(c *fiber.Ctx) error {
+			return httpxcommons.ValidationErrors{{Field: "name"}}
+		})
+		app.Get("/failed", func(c *fiber.Ctx) error {
+			return es.New("db: connection refused")
+		})
+		app.Get("/panic", func(c *fiber.Ctx) error {
+			panic("boom")
+		})
+		doRequest(t, app, tc.path, nil)
+		span := onlySpan(t, exporter)
+		if status := spanAttribute(span, semconv.HTTPResponseStatusCodeKey).AsInt64(); status != tc.status {
+			t.Fatalf("%s: status=%d", tc.path, status)
+		}
+		if span.Status.Code != tc.code {
+			t.Fatalf("%s IgnoreClientErrors=%v: span status=%+v", tc.path, tc.ignoreClientErrors, span.Status)
+		}
+		if len(span.Events) == 0 || span.Events[0].Name != semconv.ExceptionEventName {
+			t.Fatalf("%s: 应记录错误事件, events=%+v", tc.path, span.Events)
+		}
+	}
+	// 没有返回错误的4xx响应不标记为错误
+	app, exporter := newTracingApp(t, TracingConfig{})
+	app.Get("/missing", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNotFound)
+	})
+	doRequest(t, app, "/missing", nil)
+	if span := onlySpan(t, exporter); span.Status.Code != codes.Unset {
+		t.Fatalf("span status=%+v", span.Status)
+	}
+}
@@ -0,0 +1,241 @@
+package httpx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/coffeehc/base/errors"
+	"github.com/coffeehc/base/log"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// UploadConfig 文件上传配置。默认情况下 fasthttp 会预先解析 multipart 表单(较大的文件写入 os.TempDir),
+// 此时逐个校验已解析的文件并复制到 TempDir;同时开启 Config.StreamRequestBody 和
+// Config.DisablePreParseMultipartForm 时直接从连接流式写入 TempDir,只开启其中一个时请求体会整体读入内存,上传会失败
+type UploadConfig struct {
+	// TempDir 临时文件目录,默认为 os.TempDir()
+	TempDir string
+	// MaxFileSize 单个文件的最大字节数,小于等于0时不限制
+	MaxFileSize int64
+	// MaxTotalSize 整个请求的最大字节数,小于等于0时使用 Config.BodyLimit
+	MaxTotalSize int64
+	// MaxFiles 最多接收的文件数,小于等于0时不限制
+	MaxFiles int
+	// AllowedMIMETypes 允许的文件类型,根据文件内容判断,支持 image/* 形式,为空时不限制
+	AllowedMIMETypes []string
+}
+
+// UploadedFile 已经写入临时目录的上传文件
+type UploadedFile struct {
+	FieldName   string
+	FileName    string
+	Path        string
+	Size        int64
+	ContentType string
+	SHA256      string
+	moved       bool
+}
+
+// MoveTo 将临时文件移动到 path,移动后请求结束时不会再被删除
+func (f *UploadedFile) MoveTo(path string) error {
+	if err := os.Rename(f.Path, path); err != nil {
+		return err
+	}
+	f.Path = path
+	f.moved = true
+	return nil
+}
+
+// UploadResult 一次上传请求中的文件和普通表单字段
+type UploadResult struct {
+	Files  []*UploadedFile
+	Values map[string][]string
+}
+
+func (r *UploadResult) cleanup() {
+	for _, f := range r.Files {
+		if f.moved {
+			continue
+		}
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+			log.Error("删除上传临时文件失败", zap.String("path", f.Path), zap.Error(err))
+		}
+	}
+}
+
+// ReceiveUpload 解析 multipart/form-data 请求,将文件写入临时目录并计算 SHA-256,
+// 然后调用 fn 处理,fn 返回后未通过 MoveTo 移走的临时文件会被删除
+func ReceiveUpload(c *fiber.Ctx, config UploadConfig, fn func(result *UploadResult) error) error {
+	mediaType, params, err := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+	if err != nil || mediaType != fiber.MIMEMultipartForm || params["boundary"] == "" {
+		return fiber.ErrUnsupportedMediaType
+	}
+	if config.TempDir == "" {
+		config.TempDir = os.TempDir()
+	}
+	if config.MaxTotalSize <= 0 {
+		config.MaxTotalSize = int64(c.App().Config().BodyLimit)
+	}
+	result := &UploadResult{Values: make(map[string][]string)}
+	defer result.cleanup()
+	appConfig := c.App().Config()
+	switch {
+	case !appConfig.DisablePreParseMultipartForm:
+		err = receivePreParsed(c, &config, result)
+	case appConfig.StreamRequestBody:
+		err = receiveStream(c, &config, params["boundary"], result)
+	default:
+		err = errors.SystemError("流式接收上传文件需要同时开启 StreamRequestBody 和 DisablePreParseMultipartForm")
+	}
+	if err != nil {
+		return err
+	}
+	return fn(result)
+}
+
+// receivePreParsed 校验 fasthttp 已经解析的表单,文件复制到 TempDir
+func receivePreParsed(c *fiber.Ctx, config *UploadConfig, result *UploadResult) error {
+	if n := c.Request().Header.ContentLength(); n > 0 && int64(n) > config.MaxTotalSize {
+		return fiber.ErrRequestEntityTooLarge
+	}
+	form, err := c.MultipartForm()
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	var total int64
+	for name, values := range form.Value {
+		for _, value := range values {
+			total += int64(len(value))
+		}
+		result.Values[name] = append(result.Values[name], values...)
+	}
+	names := make([]string, 0, len(form.File))
+	for name := range form.File {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, header := range form.File[name] {
+			if config.MaxFiles > 0 && len(result.Files) >= config.MaxFiles {
+				return fiber.NewError(fiber.StatusRequestEntityTooLarge, "上传文件数量超过限制")
+			}
+			if config.MaxFileSize > 0 && header.Size > config.MaxFileSize {
+				return fiber.NewError(fiber.StatusRequestEntityTooLarge, "上传文件大小超过限制")
+			}
+			if total += header.Size; total > config.MaxTotalSize {
+				return fiber.ErrRequestEntityTooLarge
+			}
+			src, err := header.Open()
+			if err != nil {
+				return err
+			}
+			file, err := spoolFile(name, header.Filename, src, config)
+			src.Close()
+			if file != nil {
+				result.Files = append(result.Files, file)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// receiveStream 从连接中流式解析表单,文件直接写入 TempDir
+func receiveStream(c *fiber.Ctx, config *UploadConfig, boundary string, result *UploadResult) error {
+	reader := multipart.NewReader(newBudgetReader(BodyReader(c), config.MaxTotalSize), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if part.FileName() == "" {
+			value, err := io.ReadAll(part)
+			part.Close()
+			if err != nil {
+				return err
+			}
+			result.Values[part.FormName()] = append(result.Values[part.FormName()], string(value))
+			continue
+		}
+		if config.MaxFiles > 0 && len(result.Files) >= config.MaxFiles {
+			part.Close()
+			return fiber.NewError(fiber.StatusRequestEntityTooLarge, "上传文件数量超过限制")
+		}
+		file, err := spoolFile(part.FormName(), part.FileName(), part, config)
+		part.Close()
+		if file != nil {
+			result.Files = append(result.Files, file)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// spoolFile 将文件写入临时目录,出错时仍返回已创建的文件以便清理
+func spoolFile(fieldName, fileName string, part io.Reader, config *UploadConfig) (*UploadedFile, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(part, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	if !mimeAllowed(contentType, config.AllowedMIMETypes) {
+		return nil, fiber.NewError(fiber.StatusUnsupportedMediaType, fmt.Sprintf("不允许上传%s类型的文件", contentType))
+	}
+	tmp, err := os.CreateTemp(config.TempDir, "httpx-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer tmp.Close()
+	file := &UploadedFile{
+		FieldName:   fieldName,
+		FileName:    fileName,
+		Path:        tmp.Name(),
+		ContentType: contentType,
+	}
+	hash := sha256.New()
+	var src io.Reader = io.MultiReader(bytes.NewReader(head), part)
+	if config.MaxFileSize > 0 {
+		src = io.LimitReader(src, config.MaxFileSize+1)
+	}
+	size, err := io.Copy(io.MultiWriter(tmp, hash), src)
+	if err != nil {
+		return file, err
+	}
+	if config.MaxFileSize > 0 && size > config.MaxFileSize {
+		return file, fiber.NewError(fiber.StatusRequestEntityTooLarge, "上传文件大小超过限制")
+	}
+	file.Size = size
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return file, nil
+}
+
+func mimeAllowed(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	for _, a := range allowed {
+		if a == mediaType || (strings.HasSuffix(a, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(a, "*"))) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package httpx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gofiber/fiber/v2"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+type uploadPart struct {
+	field    string
+	fileName string
+	data     []byte
+}
+
+func multipartBody(t *testing.T, parts ...uploadPart) ([]byte, string) {
+	t.Helper()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, part := range parts {
+		if part.fileName == "" {
+			writer.WriteField(part.field, string(part.data))
+			continue
+		}
+		w, err := writer.CreateFormFile(part.field, part.fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(part.data)
+	}
+	writer.Close()
+	return body.Bytes(), writer.FormDataContentType()
+}
+
+// upload 使用 appConfig 创建应用并上传 parts,返回状态码和 fn 收到的结果
+func upload(t *testing.T, appConfig fiber.Config, config UploadConfig, parts ...uploadPart) (int, *UploadResult) {
+	t.Helper()
+	app := fiber.New(appConfig)
+	var received *UploadResult
+	app.Post("/upload", func(c *fiber.Ctx) error {
+		return ReceiveUpload(c, config, func(result *UploadResult) error {
+			received = result
+			for _, f := range result.Files {
+				if _, err := os.Stat(f.Path); err != nil {
+					t.Errorf("处理时临时文件应存在: %v", err)
+				}
+			}
+			return nil
+		})
+	})
+	body, contentType := multipartBody(t, parts...)
+	req := httptest.NewRequest(fiber.MethodPost, "/upload", bytes.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, contentType)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, received
+}
+
+func tempFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+var uploadModes = map[string]fiber.Config{
+	"preparsed": {},
+	"stream":    {StreamRequestBody: true, DisablePreParseMultipartForm: true},
+}
+
+func TestReceiveUpload(t *testing.T) {
+	data := append(append([]byte(nil), pngHeader...), bytes.Repeat([]byte("a"), 1000)...)
+	sum := sha256.Sum256(data)
+	for mode, appConfig := range uploadModes {
+		dir := t.TempDir()
+		status, result := upload(t, appConfig, UploadConfig{TempDir: dir, AllowedMIMETypes: []string{"image/*"}},
+			uploadPart{field: "name", data: []byte("avatar")},
+			uploadPart{field: "file", fileName: "a.png", data: data})
+		if status != fiber.StatusOK {
+			t.Fatalf("%s: status=%d", mode, status)
+		}
+		if len(result.Files) != 1 || result.Values["name"][0] != "avatar" {
+			t.Fatalf("%s: got %+v", mode, result)
+		}
+		file := result.Files[0]
+		if file.SHA256 != hex.EncodeToString(sum[:]) || file.Size != int64(len(data)) || file.ContentType != "image/png" || file.FileName != "a.png" {
+			t.Fatalf("%s: got %+v", mode, file)
+		}
+		if filepath.Dir(file.Path) != dir {
+			t.Fatalf("%s: 临时文件应写入 TempDir, path=%s", mode, file.Path)
+		}
+		if names := tempFiles(t, dir); len(names) != 0 {
+			t.Fatalf("%s: 请求结束后临时文件应被删除, got %v", mode, names)
+		}
+	}
+}
+
+func TestReceiveUploadLimits(t *testing.T) {
+	small := append(append([]byte(nil), pngHeader...), bytes.Repeat([]byte("a"), 100)...)
+	large := append(append([]byte(nil), pngHeader...), bytes.Repeat([]byte("a"), 2000)...)
+	cases := []struct {
+		name   string
+		config UploadConfig
+		parts  []uploadPart
+		status int
+	}{
+		{"单个文件超过限制", UploadConfig{MaxFileSize: 1000}, []uploadPart{{field: "a", fileName: "a.png", data: small}, {field: "b", fileName: "b.png", data: large}}, fiber.StatusRequestEntityTooLarge},
+		{"总大小超过限制", UploadConfig{MaxTotalSize: 1500}, []uploadPart{{field: "a", fileName: "a.png", data: large}}, fiber.StatusRequestEntityTooLarge},
+		{"文件数量超过限制", UploadConfig{MaxFiles: 1}, []uploadPart{{field: "a", fileName: "a.png", data: small}, {field: "b", fileName: "b.png", data: small}}, fiber.StatusRequestEntityTooLarge},
+		{"文件类型不允许", UploadConfig{AllowedMIMETypes: []string{"image/*"}}, []uploadPart{{field: "a", fileName: "a.png", data: []byte("plain text")}}, fiber.StatusUnsupportedMediaType},
+	}
+	for mode, appConfig := range uploadModes {
+		for _, tc := range cases {
+			dir := t.TempDir()
+			tc.config.TempDir = dir
+			status, result := upload(t, appConfig, tc.config, tc.parts...)
+			if status != tc.status || result != nil {
+				t.Fatalf("%s %s: status=%d result=%+v", mode, tc.name, status, result)
+			}
+			if names := tempFiles(t, dir); len(names) != 0 {
+				t.Fatalf("%s %s: 失败时临时文件应被删除, got %v", mode, tc.name, names)
+			}
+		}
+	}
+}
+
+func TestReceiveUploadMoveTo(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(t.TempDir(), "kept.png")
+	app := fiber.New()
+	app.Post("/upload", func(c *fiber.Ctx) error {
+		return ReceiveUpload(c, UploadConfig{TempDir: dir}, func(result *UploadResult) error {
+			return result.Files[0].MoveTo(target)
+		})
+	})
+	body, contentType := multipartBody(t, uploadPart{field: "file", fileName: "a.png", data: pngHeader})
+	req := httptest.NewRequest(fiber.MethodPost, "/upload", bytes.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, contentType)
+	if resp, err := app.Test(req); err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("resp=%v err=%v", resp, err)
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Fatalf("MoveTo 移走的文件不应被删除: %v", err)
+	}
+}
+
+// 只关闭预解析而没有开启流式请求体时请求体已经整体读入内存,应直接失败
+func TestReceiveUploadRequiresStreaming(t *testing.T) {
+	status, result := upload(t, fiber.Config{DisablePreParseMultipartForm: true}, UploadConfig{TempDir: t.TempDir()},
+		uploadPart{field: "file", fileName: "a.png", data: pngHeader})
+	if status != fiber.StatusInternalServerError || result != nil {
+		t.Fatalf("status=%d result=%+v", status, result)
+	}
+}
@@ -0,0 +1,212 @@
+package httpx
+
+import (
+	es "errors"
+	"fmt"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"github.com/go-playground/validator/v10"
+	"google.golang.org/protobuf/proto"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// StructValidator 在 Bind 解析完成后校验对象,校验失败时返回 httpxcommons.ValidationErrors
+type StructValidator interface {
+	ValidateStruct(obj interface{}) error
+}
+
+// Validator 是 Bind 使用的校验器,默认基于 go-playground/validator,设置为 nil 时关闭校验
+var Validator StructValidator = &defaultValidator{}
+
+func validate(obj interface{}) error {
+	if Validator == nil {
+		return nil
+	}
+	return Validator.ValidateStruct(obj)
+}
+
+// ValidationRule 校验规则,v 为字段值(指针已解引用),param 为规则参数(如 min=3 中的 3)
+type ValidationRule func(v reflect.Value, param string) bool
+
+var (
+	engineOnce sync.Once
+	engine     *validator.Validate
+
+	messageMutex sync.RWMutex
+	ruleMessages = map[string]string{
+		"required": "不能为空",
+		"min":      "不能小于%s",
+		"max":      "不能大于%s",
+		"len":      "长度必须为%s",
+		"eq":       "必须等于%s",
+		"ne":       "不能等于%s",
+		"gt":       "必须大于%s",
+		"gte":      "不能小于%s",
+		"lt":       "必须小于%s",
+		"lte":      "不能大于%s",
+		"oneof":    "必须是[%s]中的一个",
+		"email":    "不是合法的邮箱地址",
+		"url":      "不是合法的URL",
+		"uuid":     "不是合法的UUID",
+		"ip":       "不是合法的IP地址",
+		"numeric":  "必须是数字",
+	}
+)
+
+// ValidateEngine 返回默认校验器使用的 go-playground/validator 实例,可用于注册结构体级别的校验等高级用法,
+// 规则使用 binding 标签,字段名优先使用 json、form、query 标签
+func ValidateEngine() *validator.Validate {
+	engineOnce.Do(func() {
+		engine = validator.New(validator.WithRequiredStructEnabled())
+		engine.SetTagName("binding")
+		engine.RegisterTagNameFunc(fieldName)
+	})
+	return engine
+}
+
+// RegisterValidationRule 注册自定义校验规则,message 中的 %s 会替换为规则参数,应在服务启动前调用
+func RegisterValidationRule(name string, rule ValidationRule, message string) error {
+	err := ValidateEngine().RegisterValidation(name, func(fl validator.FieldLevel) bool {
+		return rule(fl.Field(), fl.Param())
+	})
+	if err != nil {
+		return err
+	}
+	messageMutex.Lock()
+	defer messageMutex.Unlock()
+	ruleMessages[name] = message
+	return nil
+}
+
+func ruleMessage(rule, param string) string {
+	messageMutex.RLock()
+	message, ok := ruleMessages[rule]
+	messageMutex.RUnlock()
+	if !ok {
+		return "校验失败"
+	}
+	if strings.Contains(message, "%s") {
+		return fmt.Sprintf(message, param)
+	}
+	return message
+}
+
+// defaultValidator 使用 go-playground/validator 根据结构体的 binding 标签校验,如 `binding:"required,min=1,max=20"`,
+// 规则与 gin 一致,切片中的元素需要使用 dive 校验。对象实现了 ValidateAll() error 或 Validate() error
+// (如 protoc-gen-validate 生成的 protobuf 消息)时同时调用
+type defaultValidator struct{}
+
+func (v *defaultValidator) ValidateStruct(obj interface{}) error {
+	var errs httpxcommons.ValidationErrors
+	if _, ok := obj.(proto.Message); !ok {
+		var err error
+		errs, err = validateValue(reflect.ValueOf(obj), "", errs)
+		if err != nil {
+			return err
+		}
+	}
+	errs = append(errs, validateMethod(obj)...)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// validateValue 校验结构体,顶层为切片或数组时逐个校验其中的结构体
+func validateValue(v reflect.Value, path string, errs httpxcommons.ValidationErrors) (httpxcommons.ValidationErrors, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return errs, nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		err := ValidateEngine().Struct(v.Interface())
+		if err == nil {
+			return errs, nil
+		}
+		var fieldErrors validator.ValidationErrors
+		if !es.As(err, &fieldErrors) {
+			return errs, err
+		}
+		for _, fieldError := range fieldErrors {
+			errs = append(errs, &httpxcommons.FieldError{
+				Field:   joinFieldPath(path, trimStructName(fieldError.Namespace())),
+				Rule:    fieldError.Tag(),
+				Message: ruleMessage(fieldError.Tag(), fieldError.Param()),
+			})
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			var err error
+			errs, err = validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+			if err != nil {
+				return errs, err
+			}
+		}
+	}
+	return errs, nil
+}
+
+// trimStructName 去掉 Namespace 中的顶层结构体名称,User.items[0].name 转换为 items[0].name
+func trimStructName(namespace string) string {
+	if _, field, ok := strings.Cut(namespace, "."); ok {
+		return field
+	}
+	return namespace
+}
+
+// validateMethod 调用对象自身的校验方法,兼容 protoc-gen-validate 的错误类型
+func validateMethod(obj interface{}) httpxcommons.ValidationErrors {
+	var err error
+	switch o := obj.(type) {
+	case interface{ ValidateAll() error }:
+		err = o.ValidateAll()
+	case interface{ Validate() error }:
+		err = o.Validate()
+	default:
+		return nil
+	}
+	if err == nil {
+		return nil
+	}
+	if fieldErrors, ok := err.(httpxcommons.ValidationErrors); ok {
+		return fieldErrors
+	}
+	causes := []error{err}
+	if multi, ok := err.(interface{ AllErrors() []error }); ok {
+		causes = multi.AllErrors()
+	}
+	errs := make(httpxcommons.ValidationErrors, 0, len(causes))
+	for _, cause := range causes {
+		fieldError := &httpxcommons.FieldError{Rule: "validate", Message: cause.Error()}
+		if f, ok := cause.(interface {
+			Field() string
+			Reason() string
+		}); ok {
+			fieldError.Field = f.Field()
+			fieldError.Message = f.Reason()
+		}
+		errs = append(errs, fieldError)
+	}
+	return errs
+}
+
+// fieldName 返回校验错误中使用的字段名,优先使用 json、form、query 标签
+func fieldName(field reflect.StructField) string {
+	for _, key := range []string{"json", "form", "query"} {
+		if name, _, _ := strings.Cut(field.Tag.Get(key), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+func joinFieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
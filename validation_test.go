@@ -0,0 +1,136 @@
+package httpx
+
+import (
+	es "errors"
+	"github.com/coffeehc/httpx/httpxcommons"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type validateAddress struct {
+	City string `json:"city" binding:"required"`
+}
+
+type validateUser struct {
+	Name     string             `json:"name" binding:"required,min=2,max=8"`
+	Email    *string            `json:"email" binding:"omitempty,email"`
+	Age      *int               `json:"age" binding:"omitempty,min=18"`
+	Role     string             `json:"role" binding:"omitempty,oneof=admin user"`
+	Address  *validateAddress   `json:"address"`
+	Contacts []*validateAddress `json:"contacts" binding:"dive"`
+	Ignored  string             `json:"-" binding:"-"`
+}
+
+type validateMethodRequest struct {
+	Page int `json:"page"`
+}
+
+func (r *validateMethodRequest) Validate() error {
+	if r.Page <= 0 {
+		return es.New("page必须大于0")
+	}
+	return nil
+}
+
+func fieldErrors(t *testing.T, err error) map[string]string {
+	t.Helper()
+	var errs httpxcommons.ValidationErrors
+	if !es.As(err, &errs) {
+		t.Fatalf("应返回 ValidationErrors, got %T %v", err, err)
+	}
+	fields := make(map[string]string, len(errs))
+	for _, e := range errs {
+		fields[e.GetField()] = e.GetRule()
+	}
+	return fields
+}
+
+func TestValidateStruct(t *testing.T) {
+	email, age := "admin@example.com", 20
+	valid := &validateUser{Name: "coffee", Email: &email, Age: &age, Role: "admin", Address: &validateAddress{City: "cd"}}
+	if err := validate(valid); err != nil {
+		t.Fatalf("合法对象不应返回错误: %v", err)
+	}
+	badEmail, badAge := "not-an-email", 3
+	invalid := &validateUser{
+		Name:     "c",
+		Email:    &badEmail,
+		Age:      &badAge,
+		Role:     "root",
+		Address:  &validateAddress{},
+		Contacts: []*validateAddress{{City: "cd"}, {}},
+	}
+	got := fieldErrors(t, validate(invalid))
+	want := map[string]string{
+		"name":             "min",
+		"email":            "email",
+		"age":              "min",
+		"role":             "oneof",
+		"address.city":     "required",
+		"contacts[1].city": "required",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+// 指针字段的所有规则都作用于指针指向的值,nil 指针只校验 required
+func TestValidatePointerConsistency(t *testing.T) {
+	type request struct {
+		Email *string `json:"email" binding:"required,email"`
+		Count *int    `json:"count" binding:"required,max=3"`
+	}
+	got := fieldErrors(t, validate(&request{}))
+	if got["email"] != "required" || got["count"] != "required" {
+		t.Fatalf("nil 指针应返回 required 错误, got %v", got)
+	}
+	email, count := "bad", 5
+	got = fieldErrors(t, validate(&request{Email: &email, Count: &count}))
+	if got["email"] != "email" || got["count"] != "max" {
+		t.Fatalf("指针指向的值应按规则校验, got %v", got)
+	}
+}
+
+func TestValidateTopLevelSlice(t *testing.T) {
+	got := fieldErrors(t, validate(&[]validateAddress{{City: "cd"}, {}}))
+	if got["[1].city"] != "required" || len(got) != 1 {
+		t.Fatalf("got %v", got)
+	}
+	if err := validate(&map[string]interface{}{"a": 1}); err != nil {
+		t.Fatalf("非结构体对象不应校验: %v", err)
+	}
+}
+
+func TestValidateMethod(t *testing.T) {
+	err := validate(&validateMethodRequest{})
+	var errs httpxcommons.ValidationErrors
+	if !es.As(err, &errs) || len(errs) != 1 || errs[0].GetRule() != "validate" {
+		t.Fatalf("应调用对象的 Validate 方法, got %v", err)
+	}
+	if err := validate(&validateMethodRequest{Page: 1}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegisterValidationRule(t *testing.T) {
+	err := RegisterValidationRule("prefix", func(v reflect.Value, param string) bool {
+		return strings.HasPrefix(v.String(), param)
+	}, "必须以%s开头")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type request struct {
+		Code *string `json:"code" binding:"omitempty,prefix=HX"`
+	}
+	code := "AB01"
+	err = validate(&request{Code: &code})
+	var errs httpxcommons.ValidationErrors
+	if !es.As(err, &errs) || len(errs) != 1 || errs[0].GetMessage() != "必须以HX开头" {
+		t.Fatalf("got %v", err)
+	}
+	code = "HX01"
+	if err := validate(&request{Code: &code}); err != nil {
+		t.Fatal(err)
+	}
+}